@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"./storage"
+	"./warc"
+)
+
+// Archiver ... Keeps WARC writers for each crawler and industry. Nil archiver means that WARC output is disabled.
+// If `Upload` storage is set, completed files are moved there
+type Archiver struct {
+	Path    string
+	MaxSize int64
+	Upload  storage.Storage
+
+	mutex   sync.Mutex
+	writers map[string]*warc.Writer
+}
+
+// NewArchiver ... Creates archiver from configuration. Returns nil if WARC output is not used
+func NewArchiver(config warcConfig, upload storage.Storage) *Archiver {
+	if !config.Use {
+		return nil
+	}
+	return &Archiver{Path: config.Path, MaxSize: int64(config.MaxSize) * 1024 * 1024, Upload: upload,
+		writers: map[string]*warc.Writer{}}
+}
+
+func (a *Archiver) writer(crawler string, industry string) (*warc.Writer, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key := crawler + "/" + industry
+	if w, found := a.writers[key]; found {
+		return w, nil
+	}
+	dir := path.Join(a.Path, crawler, industry)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("[Archiver] error: %v", err)
+	}
+	w := warc.NewWriter(dir, crawler, a.MaxSize)
+	if a.Upload != nil {
+		w.OnFinish = func(filename string) error {
+			if err := putFile(a.Upload, filepath.ToSlash(filename), filename); err != nil {
+				return err
+			}
+			return os.Remove(filename)
+		}
+	}
+	a.writers[key] = w
+	return w, nil
+}
+
+// WriteExchange ... Writes request and response records of fetched URL
+func (a *Archiver) WriteExchange(crawler string, industry string, targetURI string, reqHeader http.Header,
+	status int, respHeader http.Header, payload []byte) error {
+	if a == nil {
+		return nil
+	}
+	w, err := a.writer(crawler, industry)
+	if err != nil {
+		return err
+	}
+	if reqHeader == nil {
+		reqHeader = http.Header{}
+	}
+
+	response := warc.NewResponseRecord(targetURI, status, respHeader, payload)
+	request := warc.NewRequestRecord("GET", targetURI, reqHeader)
+	warc.Concurrent(request, response)
+	return w.Write(request, response)
+}
+
+// WriteResource ... Writes content replayed by web archive as `resource` record with its capture time,
+// since headers of replay are not headers of original response
+func (a *Archiver) WriteResource(crawler string, industry string, targetURI string, sourceURI string,
+	capturedAt time.Time, contentType string, payload []byte) error {
+	if a == nil {
+		return nil
+	}
+	w, err := a.writer(crawler, industry)
+	if err != nil {
+		return err
+	}
+	return w.Write(warc.NewResourceRecord(targetURI, sourceURI, capturedAt, contentType, payload))
+}
+
+// WriteRecord ... Writes already existing record, e.g. the one loaded from web archive
+func (a *Archiver) WriteRecord(crawler string, industry string, record *warc.Record) error {
+	if a == nil {
+		return nil
+	}
+	w, err := a.writer(crawler, industry)
+	if err != nil {
+		return err
+	}
+	return w.Write(record)
+}
+
+// Close ... Closes all opened WARC files, so they are moved into storage if it is set
+func (a *Archiver) Close() {
+	if a == nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, w := range a.writers {
+		if err := w.Close(); err != nil {
+			fmt.Printf("[Archiver] error: %v\n", err)
+		}
+	}
+}
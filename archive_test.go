@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"./warc"
+)
+
+// archivedRecords ... Closes archiver and reads records of all its WARC files
+func archivedRecords(t *testing.T, archive *Archiver) []*warc.Record {
+	archive.Close()
+	files, err := filepath.Glob(filepath.Join(archive.Path, "*", "*", "*.warc.gz"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("WARC files = %v, %v", files, err)
+	}
+	records := []*warc.Record{}
+	for _, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := warc.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			record, err := reader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		f.Close()
+	}
+	return records
+}
+
+func TestArchiveResumedDownload(t *testing.T) {
+	dir := t.TempDir()
+	archive := NewArchiver(warcConfig{Use: true, Path: filepath.Join(dir, "warc")}, nil)
+	payload := []byte("%PDF-1.4 whole file")
+	filename := filepath.Join(dir, "report.pdf")
+	if err := ioutil.WriteFile(filename, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last attempt of download loaded only the rest of file
+	file := DownloadResult{Path: filename, Status: http.StatusPartialContent, Header: http.Header{
+		"Content-Type": {"application/pdf"}, "Content-Range": {"bytes 9-18/19"}, "Content-Length": {"10"}}}
+	if err := archiveDownload("http://a.com/report.pdf", file, GoogleConfig{Archive: archive, Industry: "Tech"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, record := range archivedRecords(t, archive) {
+		if record.Type() != "response" {
+			continue
+		}
+		resp, body, err := record.HTTPResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Range") != "" ||
+			resp.Header.Get("Content-Length") != "19" || string(body) != string(payload) {
+			t.Fatalf("archived %v %v: %q", resp.StatusCode, resp.Header, body)
+		}
+		return
+	}
+	t.Fatal("response is not archived")
+}
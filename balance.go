@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	d "./db"
+)
+
+// errClassSaturated ... Returned when class of company already has target amount of data. It is a kind of
+// quota, so crawlers stop with the company the same way
+var errClassSaturated = fmt.Errorf("%w: class target reached", errQuotaExceeded)
+
+// classTarget ... Target amount of documents and bytes of class, 0 means no target
+type classTarget struct {
+	Documents int
+	Bytes     int64
+}
+
+// Balance ... Targets of collected data per industry class. Companies of classes which reached their targets
+// are skipped, under-filled classes are crawled first. Nil balance means no targets
+type Balance struct {
+	Default classTarget
+	Targets map[string]classTarget
+
+	mutex   sync.Mutex
+	classes map[int]string
+	files   map[string]int
+	bytes   map[string]int64
+}
+
+// NewBalance ... Creates balance from configuration and totals of already collected documents of companies.
+// Returns nil if balancing is not used
+func NewBalance(config balanceConfig, companies []d.Companies, totals map[int]d.DocumentTotal) (*Balance, error) {
+	if !config.Use {
+		return nil, nil
+	}
+	size, err := parseSize(config.Size)
+	if err != nil {
+		return nil, err
+	}
+	b := &Balance{Default: classTarget{config.Documents, size}, Targets: map[string]classTarget{},
+		classes: map[int]string{}, files: map[string]int{}, bytes: map[string]int64{}}
+	for class, target := range config.Classes {
+		if size, err = parseSize(target.Size); err != nil {
+			return nil, err
+		}
+		b.Targets[class] = classTarget{target.Documents, size}
+	}
+
+	for _, c := range companies {
+		class := c.Class
+		b.classes[c.ID] = class
+		b.files[class] += totals[c.ID].Files
+		b.bytes[class] += totals[c.ID].Bytes
+	}
+	return b, nil
+}
+
+func (b *Balance) target(class string) classTarget {
+	if target, found := b.Targets[class]; found {
+		return target
+	}
+	return b.Default
+}
+
+// fill ... Returns part of target which class already has, the most filled of documents and bytes is taken
+func (b *Balance) fill(class string) float64 {
+	target := b.target(class)
+	fill := 0.0
+	if target.Documents > 0 {
+		fill = float64(b.files[class]) / float64(target.Documents)
+	}
+	if target.Bytes > 0 && float64(b.bytes[class])/float64(target.Bytes) > fill {
+		fill = float64(b.bytes[class]) / float64(target.Bytes)
+	}
+	return fill
+}
+
+// Check ... Returns error if class of company already has enough data
+func (b *Balance) Check(companyID int) error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if class := b.classes[companyID]; b.fill(class) >= 1 {
+		return fmt.Errorf("%w: %v", errClassSaturated, class)
+	}
+	return nil
+}
+
+// Add ... Counts saved document for class of company
+func (b *Balance) Add(companyID int, size int64) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	class := b.classes[companyID]
+	b.files[class]++
+	b.bytes[class] += size
+}
+
+// Order ... Drops companies of saturated classes and sorts others, so companies of the least filled classes go first
+func (b *Balance) Order(companies []d.Companies) []d.Companies {
+	if b == nil {
+		return companies
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ordered := []d.Companies{}
+	fills := map[int]float64{}
+	for _, c := range companies {
+		fill := b.fill(c.Class)
+		if fill >= 1 {
+			continue
+		}
+		fills[c.ID] = fill
+		ordered = append(ordered, c)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return fills[ordered[i].ID] < fills[ordered[j].ID]
+	})
+	return ordered
+}
+
+// Print ... Prints how much of target each class has
+func (b *Balance) Print() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	set := map[string]struct{}{}
+	for _, class := range b.classes {
+		set[class] = struct{}{}
+	}
+	classes := []string{}
+	for class := range set {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Printf("Class %v: %v documents (%v), %.0f%% of target\n", class, b.files[class],
+			formatSize(b.bytes[class]), b.fill(class)*100)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	d "./db"
+	"./storage"
+)
+
+// classifiedMemory ... Returns repository with companies a.com, b.com of group Banks and c.com of group Oil
+func classifiedMemory() *d.Memory {
+	banks, oil := 1, 2
+	taxonomy := &d.Taxonomy{Groups: map[int]d.IndustryGroups{
+		banks: {ID: banks, IndustryGroups: "Banks"},
+		oil:   {ID: oil, IndustryGroups: "Oil"},
+	}}
+	return d.NewMemory([]d.Companies{
+		{URL: "a.com", IndustryGroupID: &banks},
+		{URL: "b.com", IndustryGroupID: &banks},
+		{URL: "c.com", IndustryGroupID: &oil},
+	}, taxonomy)
+}
+
+func TestBalanceOrder(t *testing.T) {
+	memory := classifiedMemory()
+	memory.AddDocument(&d.Documents{CompanyID: 1, Crawler: "colly", Path: "colly/Banks/a.com/index.html", Size: 100})
+	companies := memory.GetCompanies()
+	balance, err := NewBalance(balanceConfig{Use: true, Documents: 2,
+		Classes: map[string]classTargetConfig{"Oil": {Documents: 4}}}, companies, memory.DocumentTotals())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty class goes first
+	ordered := balance.Order(companies)
+	if len(ordered) != 3 || ordered[0].URL != "c.com" || ordered[1].URL != "a.com" || ordered[2].URL != "b.com" {
+		t.Fatalf("Order = %+v", ordered)
+	}
+	if err = balance.Check(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saturated class is dropped and its companies can't save more
+	balance.Add(2, 100)
+	ordered = balance.Order(companies)
+	if len(ordered) != 1 || ordered[0].URL != "c.com" {
+		t.Fatalf("Order of saturated = %+v", ordered)
+	}
+	if err = balance.Check(1); !errors.Is(err, errClassSaturated) || !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("Check = %v", err)
+	}
+	if err = balance.Check(3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nil balance keeps all companies
+	var none *Balance
+	if len(none.Order(companies)) != 3 || none.Check(1) != nil {
+		t.Fatal("nil balance limits companies")
+	}
+}
+
+func TestBalanceStopsSaving(t *testing.T) {
+	memory := classifiedMemory()
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	var err error
+	store.Balance, err = NewBalance(balanceConfig{Use: true, Documents: 1}, memory.GetCompanies(), memory.DocumentTotals())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.Save(d.Documents{CompanyID: 1, Crawler: "colly"}, []byte("a"), "colly/Banks/a.com/a.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Save(d.Documents{CompanyID: 2, Crawler: "colly"}, []byte("b"), "colly/Banks/b.com/b.html", nil); !errors.Is(err, errClassSaturated) {
+		t.Fatalf("Save to saturated class = %v", err)
+	}
+	if err = store.Check(2); !errors.Is(err, errClassSaturated) || store.Check(3) != nil {
+		t.Fatalf("Check = %v", err)
+	}
+	if documents := memory.GetDocuments(); len(documents) != 1 {
+		t.Fatalf("documents = %+v", documents)
+	}
+}
+
+func TestBalanceTargets(t *testing.T) {
+	memory := classifiedMemory()
+	memory.AddDocument(&d.Documents{CompanyID: 1, Crawler: "colly", Path: "colly/Banks/a.com/index.html", Size: 512 * 1024})
+	memory.AddDocument(&d.Documents{CompanyID: 3, Crawler: "colly", Path: "colly/Oil/c.com/index.html", Size: 100})
+	companies := memory.GetCompanies()
+
+	// The most filled of documents and bytes counts, class target replaces default one
+	balance, err := NewBalance(balanceConfig{Use: true, Documents: 100, Size: "1MB",
+		Classes: map[string]classTargetConfig{"Oil": {Documents: 2}}}, companies, memory.DocumentTotals())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fill := balance.fill("Banks"); fill != 0.5 {
+		t.Fatalf("fill of Banks = %v", fill)
+	}
+	if fill := balance.fill("Oil"); fill != 0.5 {
+		t.Fatalf("fill of Oil = %v", fill)
+	}
+	balance.Add(2, 512*1024)
+	balance.Add(3, 1<<30)
+	if balance.Check(1) == nil || balance.Check(3) == nil || len(balance.Order(companies)) != 0 {
+		t.Fatal("filled classes are not saturated")
+	}
+
+	if balance, err = NewBalance(balanceConfig{Use: true, Size: "many"}, companies, nil); err == nil {
+		t.Fatal("bad size is accepted")
+	}
+	if balance, err = NewBalance(balanceConfig{Use: true, Classes: map[string]classTargetConfig{"Oil": {Size: "-1"}}}, companies, nil); err == nil {
+		t.Fatal("bad size of class is accepted")
+	}
+	if balance, err = NewBalance(balanceConfig{Documents: 1}, companies, nil); balance != nil || err != nil {
+		t.Fatalf("disabled balance = %v, %v", balance, err)
+	}
+}
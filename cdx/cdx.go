@@ -0,0 +1,215 @@
+package cdx
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"../warc"
+)
+
+// Default addresses of Common Crawl services
+const (
+	CommonIndexURL = "https://index.commoncrawl.org"
+	CommonDataURL  = "https://data.commoncrawl.org"
+)
+
+// Record ... Entry of CDX index describing one capture stored in WARC file
+type Record struct {
+	URLKey       string `json:"urlkey"`
+	Timestamp    string `json:"timestamp"`
+	URL          string `json:"url"`
+	MIME         string `json:"mime"`
+	MIMEDetected string `json:"mime-detected"`
+	Status       string `json:"status"`
+	Digest       string `json:"digest"`
+	Length       string `json:"length"`
+	Offset       string `json:"offset"`
+	Filename     string `json:"filename"`
+}
+
+// Time ... Returns capture time of the record
+func (r Record) Time() (time.Time, error) {
+	return time.Parse("20060102150405", r.Timestamp)
+}
+
+// Query ... Parameters of CDX index search. Filters use index server syntax,
+// e.g. `status:200`, `~mime:application/pdf|text/html`, `!~url:.*\.css`.
+// Collapse fields are supported only by Wayback Machine
+type Query struct {
+	URL       string
+	MatchType string
+	Filters   []string
+	Collapse  []string
+	From      string
+	To        string
+	Limit     int
+}
+
+func (q Query) values() url.Values {
+	values := url.Values{}
+	values.Set("url", q.URL)
+	values.Set("output", "json")
+	if q.MatchType != "" {
+		values.Set("matchType", q.MatchType)
+	}
+	for _, f := range q.Filters {
+		values.Add("filter", f)
+	}
+	if q.From != "" {
+		values.Set("from", q.From)
+	}
+	if q.To != "" {
+		values.Set("to", q.To)
+	}
+	return values
+}
+
+// Client ... Works with CDX Index API of Common Crawl and fetches records from its WARC files
+type Client struct {
+	IndexURL string
+	DataURL  string
+	HTTP     *http.Client
+}
+
+// NewClient ... Creates client for Common Crawl. Empty addresses are replaced with defaults
+func NewClient(indexURL string, dataURL string, timeout time.Duration) *Client {
+	if indexURL == "" {
+		indexURL = CommonIndexURL
+	}
+	if dataURL == "" {
+		dataURL = CommonDataURL
+	}
+	return &Client{
+		IndexURL: strings.TrimRight(indexURL, "/"),
+		DataURL:  strings.TrimRight(dataURL, "/"),
+		HTTP:     &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) indexRequest(collection string, values url.Values) (*http.Response, error) {
+	endpoint := fmt.Sprintf("%v/%v-index?%v", c.IndexURL, collection, values.Encode())
+	resp, err := c.HTTP.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("index status %v", resp.Status)
+	}
+	return resp, nil
+}
+
+// NumPages ... Returns amount of result pages of the query in given collection
+func (c *Client) NumPages(collection string, q Query) (int, error) {
+	values := q.values()
+	values.Set("showNumPages", "true")
+	resp, err := c.indexRequest(collection, values)
+	if err != nil {
+		return 0, fmt.Errorf("[NumPages] error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	info := struct {
+		Pages int `json:"pages"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0, fmt.Errorf("[NumPages] decode error: %v", err)
+	}
+	return info.Pages, nil
+}
+
+// Page ... Returns records from one result page of the query. Missing captures give empty result
+func (c *Client) Page(collection string, q Query, page int) ([]Record, error) {
+	values := q.values()
+	values.Set("page", strconv.Itoa(page))
+	resp, err := c.indexRequest(collection, values)
+	if err != nil {
+		return nil, fmt.Errorf("[Page] error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	records := []Record{}
+	if resp.StatusCode == http.StatusNotFound {
+		return records, nil
+	}
+
+	// Each line of response is a separate JSON object
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record := Record{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return records, fmt.Errorf("[Page] decode error: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Search ... Returns records from all result pages of the query, but not more than `Limit` if it is set
+func (c *Client) Search(collection string, q Query) ([]Record, error) {
+	pages, err := c.NumPages(collection, q)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	for page := 0; page < pages; page++ {
+		found, err := c.Page(collection, q, page)
+		records = append(records, found...)
+		if err != nil {
+			return records, err
+		}
+		if q.Limit > 0 && len(records) >= q.Limit {
+			return records[:q.Limit], nil
+		}
+	}
+	return records, nil
+}
+
+// Fetch ... Loads WARC record of the capture using HTTP range request
+func (c *Client) Fetch(r Record) (*warc.Record, error) {
+	offset, err := strconv.ParseInt(r.Offset, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("[Fetch] bad offset: %v", err)
+	}
+	length, err := strconv.ParseInt(r.Length, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("[Fetch] bad length: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", c.DataURL+"/"+r.Filename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("[Fetch] error: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("[Fetch] error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[Fetch] status %v", resp.Status)
+	}
+
+	reader, err := warc.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("[Fetch] error: %v", err)
+	}
+	record, err := reader.Next()
+	if err != nil {
+		return nil, fmt.Errorf("[Fetch] error: %v", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,203 @@
+package cdx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Index pages served by fake index server
+var fakePages = [][]string{
+	{`{"urlkey":"com,a)/","timestamp":"20190101000000","url":"http://a.com/","mime":"text/html","status":"200","offset":"0","length":"10","filename":"a.warc.gz"}`,
+		`{"urlkey":"com,a)/b.pdf","timestamp":"20190102000000","url":"http://a.com/b.pdf","mime":"application/pdf","status":"200","offset":"10","length":"20","filename":"a.warc.gz"}`},
+	{`{"urlkey":"com,a)/c","timestamp":"20190103000000","url":"http://a.com/c","mime":"text/html","status":"200","offset":"30","length":"5","filename":"a.warc.gz"}`},
+}
+
+// fakeIndex ... Serves collection `CC-TEST` by pages, `CC-MISSING` has no captures and `CC-BROKEN` fails.
+// Queries of index requests are recorded
+type fakeIndex struct {
+	mutex   sync.Mutex
+	queries []url.Values
+}
+
+func (f *fakeIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.queries = append(f.queries, r.URL.Query())
+	f.mutex.Unlock()
+
+	switch r.URL.Path {
+	case "/CC-MISSING-index":
+		http.NotFound(w, r)
+	case "/CC-BROKEN-index":
+		http.Error(w, "broken", http.StatusInternalServerError)
+	case "/CC-TEST-index":
+		if r.URL.Query().Get("showNumPages") == "true" {
+			fmt.Fprintf(w, `{"pages": %d, "pageSize": 5, "blocks": 2}`, len(fakePages))
+			return
+		}
+		var page int
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		if page >= len(fakePages) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.Join(fakePages[page], "\n") + "\n"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	index := &fakeIndex{}
+	server := httptest.NewServer(index)
+	defer server.Close()
+	client := NewClient(server.URL+"/", "", time.Second)
+
+	pages, err := client.NumPages("CC-TEST", Query{URL: "a.com"})
+	if err != nil || pages != 2 {
+		t.Fatalf("NumPages = %v, %v", pages, err)
+	}
+	records, err := client.Search("CC-TEST", Query{URL: "a.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{}
+	for _, r := range records {
+		urls = append(urls, r.URL)
+	}
+	if want := []string{"http://a.com/", "http://a.com/b.pdf", "http://a.com/c"}; !reflect.DeepEqual(urls, want) {
+		t.Fatalf("Search = %v, want %v", urls, want)
+	}
+	if records[1].MIME != "application/pdf" || records[1].Offset != "10" || records[1].Length != "20" {
+		t.Fatalf("record is not decoded: %+v", records[1])
+	}
+	if captured, err := records[2].Time(); err != nil || !captured.Equal(time.Date(2019, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Time = %v, %v", captured, err)
+	}
+
+	// Limit stops paging as soon as enough records are found
+	index.queries = nil
+	records, err = client.Search("CC-TEST", Query{URL: "a.com", Limit: 1})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Search with limit = %v, %v", records, err)
+	}
+	if len(index.queries) != 2 {
+		t.Fatalf("Search with limit made %v requests, want 2", len(index.queries))
+	}
+}
+
+func TestQueryParameters(t *testing.T) {
+	index := &fakeIndex{}
+	server := httptest.NewServer(index)
+	defer server.Close()
+	client := NewClient(server.URL, "", time.Second)
+
+	q := Query{URL: "a.com/*", MatchType: "domain", Filters: []string{"status:200", "~mime:application/pdf|text/html"},
+		From: "2019", To: "2020"}
+	if _, err := client.Page("CC-TEST", q, 1); err != nil {
+		t.Fatal(err)
+	}
+	got := index.queries[0]
+	want := map[string][]string{"url": {"a.com/*"}, "output": {"json"}, "matchType": {"domain"}, "page": {"1"},
+		"filter": {"status:200", "~mime:application/pdf|text/html"}, "from": {"2019"}, "to": {"2020"}}
+	for key, values := range want {
+		if !reflect.DeepEqual(got[key], values) {
+			t.Errorf("parameter %v = %v, want %v", key, got[key], values)
+		}
+	}
+}
+
+func TestIndexStatus(t *testing.T) {
+	server := httptest.NewServer(&fakeIndex{})
+	defer server.Close()
+	client := NewClient(server.URL, "", time.Second)
+
+	// Missing captures are not an error
+	records, err := client.Page("CC-MISSING", Query{URL: "a.com"}, 0)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Page of missing captures = %v, %v", records, err)
+	}
+	if _, err = client.NumPages("CC-BROKEN", Query{URL: "a.com"}); err == nil {
+		t.Fatal("NumPages: error is expected for status 500")
+	}
+	if _, err = client.Page("CC-BROKEN", Query{URL: "a.com"}, 0); err == nil {
+		t.Fatal("Page: error is expected for status 500")
+	}
+	if _, err = client.Search("CC-BROKEN", Query{URL: "a.com"}); err == nil {
+		t.Fatal("Search: error is expected for status 500")
+	}
+}
+
+// gzipMember ... Returns WARC response record compressed as separate gzip member
+func gzipMember(t *testing.T, target string, payload string) []byte {
+	block := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + payload
+	record := fmt.Sprintf("WARC/1.0\r\nWARC-Type: response\r\nWARC-Target-URI: <%v>\r\nWARC-Date: 2019-01-01T00:00:00Z\r\n"+
+		"Content-Length: %d\r\n\r\n%v\r\n\r\n", target, len(block), block)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(record)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchRange(t *testing.T) {
+	first := gzipMember(t, "http://a.com/", "<html>first</html>")
+	second := gzipMember(t, "http://a.com/c", "<html>second</html>")
+	data := append(append([]byte{}, first...), second...)
+
+	ranges := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/crawl/a.warc.gz":
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "a.warc.gz", time.Time{}, bytes.NewReader(data))
+		case "/crawl/forbidden.warc.gz":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient("", server.URL, time.Second)
+
+	// Second member is read from the middle of file
+	record := Record{Filename: "crawl/a.warc.gz", Offset: fmt.Sprint(len(first)), Length: fmt.Sprint(len(second))}
+	fetched, err := client.Fetch(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("bytes=%d-%d", len(first), len(data)-1); len(ranges) != 1 || ranges[0] != want {
+		t.Fatalf("Range = %v, want %v", ranges, want)
+	}
+	if fetched.Type() != "response" || fetched.TargetURI() != "http://a.com/c" {
+		t.Fatalf("fetched record %v of %v", fetched.Type(), fetched.TargetURI())
+	}
+	resp, payload, err := fetched.HTTPResponse()
+	if err != nil || resp.StatusCode != 200 || string(payload) != "<html>second</html>" {
+		t.Fatalf("HTTPResponse = %v, %q, %v", resp, payload, err)
+	}
+
+	for _, bad := range []Record{
+		{Filename: "crawl/forbidden.warc.gz", Offset: "0", Length: "10"},
+		{Filename: "crawl/missing.warc.gz", Offset: "0", Length: "10"},
+		{Filename: "crawl/a.warc.gz", Offset: "x", Length: "10"},
+		{Filename: "crawl/a.warc.gz", Offset: "0", Length: ""},
+		{Filename: "crawl/a.warc.gz", Offset: "3", Length: "10"},
+	} {
+		if _, err := client.Fetch(bad); err == nil {
+			t.Errorf("Fetch(%+v): error is expected", bad)
+		}
+	}
+}
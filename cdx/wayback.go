@@ -0,0 +1,136 @@
+package cdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default addresses of Internet Archive services
+const (
+	WaybackCDXURL = "https://web.archive.org/cdx/search/cdx"
+	WaybackWebURL = "https://web.archive.org/web"
+)
+
+// Amount of rows requested from Wayback CDX server at once
+const waybackPageSize = 1000
+
+// WaybackClient ... Works with CDX server of Internet Archive's Wayback Machine. Filters of its queries use
+// Wayback field names, e.g. `statuscode:200`, `mimetype:application/pdf`, `!mimetype:text/css`
+type WaybackClient struct {
+	CDXURL string
+	WebURL string
+	HTTP   *http.Client
+}
+
+// NewWaybackClient ... Creates client for Wayback Machine. Empty addresses are replaced with defaults
+func NewWaybackClient(cdxURL string, webURL string, timeout time.Duration) *WaybackClient {
+	if cdxURL == "" {
+		cdxURL = WaybackCDXURL
+	}
+	if webURL == "" {
+		webURL = WaybackWebURL
+	}
+	return &WaybackClient{
+		CDXURL: strings.TrimRight(cdxURL, "/"),
+		WebURL: strings.TrimRight(webURL, "/"),
+		HTTP:   &http.Client{Timeout: timeout},
+	}
+}
+
+// page ... Returns one page of records and key to resume from, which is empty on the last page
+func (c *WaybackClient) page(q Query, resumeKey string) ([]Record, string, error) {
+	values := q.values()
+	values.Set("fl", "urlkey,timestamp,original,mimetype,statuscode,digest,length")
+	values.Set("limit", strconv.Itoa(waybackPageSize))
+	values.Set("showResumeKey", "true")
+	for _, field := range q.Collapse {
+		values.Add("collapse", field)
+	}
+	if resumeKey != "" {
+		values.Set("resumeKey", resumeKey)
+	}
+
+	resp, err := c.HTTP.Get(c.CDXURL + "?" + values.Encode())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %v", resp.Status)
+	}
+
+	// Response is array of rows, first one is header. Resume key follows an empty row
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	rows := [][]string{}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err = json.Unmarshal(body, &rows); err != nil {
+			return nil, "", fmt.Errorf("decode error: %v", err)
+		}
+	}
+
+	records := []Record{}
+	nextKey := ""
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(row) == 0 {
+			if i+1 < len(rows) && len(rows[i+1]) > 0 {
+				nextKey = rows[i+1][0]
+			}
+			break
+		}
+		if len(row) < 7 {
+			continue
+		}
+		records = append(records, Record{URLKey: row[0], Timestamp: row[1], URL: row[2], MIME: row[3],
+			Status: row[4], Digest: row[5], Length: row[6]})
+	}
+	return records, nextKey, nil
+}
+
+// Search ... Returns captures matching the query, but not more than `Limit` if it is set
+func (c *WaybackClient) Search(q Query) ([]Record, error) {
+	records := []Record{}
+	resumeKey := ""
+	for {
+		found, nextKey, err := c.page(q, resumeKey)
+		records = append(records, found...)
+		if err != nil {
+			return records, fmt.Errorf("[Search] error: %v", err)
+		}
+		if q.Limit > 0 && len(records) >= q.Limit {
+			return records[:q.Limit], nil
+		}
+		if nextKey == "" {
+			return records, nil
+		}
+		resumeKey = nextKey
+	}
+}
+
+// Fetch ... Loads original content of the capture without Wayback Machine modifications
+func (c *WaybackClient) Fetch(r Record) (*http.Response, []byte, error) {
+	resp, err := c.HTTP.Get(fmt.Sprintf("%v/%vid_/%v", c.WebURL, r.Timestamp, r.URL))
+	if err != nil {
+		return nil, nil, fmt.Errorf("[Fetch] error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil, fmt.Errorf("[Fetch] status %v", resp.Status)
+	}
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, fmt.Errorf("[Fetch] error: %v", err)
+	}
+	return resp, payload, nil
+}
@@ -2,46 +2,98 @@ package main
 
 import (
 	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 
+	d "./db"
 	cly "github.com/gocolly/colly"
 )
 
 // CollyResultChan ... result of work of `CrawlSite` function
 type CollyResultChan struct {
-	URL    string
-	Error  error
-	Loaded uint
-	Done   bool
+	URL     string
+	Error   error
+	Loaded  int64
+	Done    bool
+	Stopped bool
+	Skipped bool
 }
 
 // CollyConfig ... Holds configuration parameters for Colly crawler
 type CollyConfig struct {
-	ResChanel     chan CollyResultChan
-	MaxFileSize   int
-	MaxHTMLLoad   uint
-	WorkMinutes   int
-	MaxAmount     int
-	Extensions    []string
-	RandomizeName bool
+	ResChanel   chan CollyResultChan
+	MaxFileSize int
+	MaxHTMLLoad uint
+	WorkMinutes int
+	MaxAmount   int
+	Extensions  []string
+	Archive     *Archiver
+	Store       *DocumentStore
+	Industry    string
+	CompanyID   int
+	Domains     []string
+	StartURLs   []string
+	// Fallbacks ... Other base URLs of sites which are not resolved yet by their start URLs
+	Fallbacks map[string][]string
 }
 
-// CrawlSite ... Crawl choosen URL and saves found files
+// minSiteLoad ... Bytes loaded from start URL of site, below which site is also crawled from its other base URLs
+const minSiteLoad = 25 * 1024
+
+// allowedDomains ... Returns domains which crawler may visit on sites of company, sites are domains or URLs
+func allowedDomains(sites []string) []string {
+	domains := []string{"s3.amazonaws.com"}
+	seen := map[string]struct{}{}
+	for _, site := range sites {
+		host, hostPort := strings.ToLower(site), ""
+		if u, err := neturl.Parse(site); err == nil && u.Host != "" {
+			// Colly compares domains with host of URL, which includes port if it is set
+			host, hostPort = u.Hostname(), u.Host
+		}
+		domain := companyDomain(site)
+		for _, allowed := range []string{domain, "www." + domain, "sso." + domain, host, hostPort} {
+			if allowed == "" {
+				continue
+			}
+			if _, found := seen[allowed]; !found {
+				seen[allowed] = struct{}{}
+				domains = append(domains, allowed)
+			}
+		}
+	}
+	return domains
+}
+
+// CrawlSite ... Crawl choosen URL and additional domains of company and saves found files. Sites are visited
+// from their resolved start URLs, sites which moved to another domain are visited there
 func CrawlSite(urlSite string, saveto string, config CollyConfig) {
 	defer func() {
 		if r := recover(); r != nil {
 		}
 	}()
 
+	if err := config.Store.Check(config.CompanyID); err != nil {
+		config.ResChanel <- CollyResultChan{URL: urlSite, Error: err}
+		config.ResChanel <- CollyResultChan{URL: urlSite, Done: true, Stopped: true}
+		return
+	}
+
 	url := "https://" + urlSite
 	downloaded := 0
-	var loadedSize uint
-	maxLoadSize := config.MaxHTMLLoad * 1024
+	// Sizes of saved files and HTML pages among them in bytes
+	var loadedSize, htmlSize int64
+	maxHTMLSize := int64(config.MaxHTMLLoad) * 1024 * 1024
 	waitTime := time.Minute * time.Duration(config.WorkMinutes)
 	c := cly.NewCollector()
-	c.AllowedDomains = []string{"www." + urlSite, "sso." + urlSite, urlSite, "s3.amazonaws.com"}
+	sites := append(append([]string{urlSite}, config.Domains...), config.StartURLs...)
+	for _, fallbacks := range config.Fallbacks {
+		sites = append(sites, fallbacks...)
+	}
+	c.AllowedDomains = allowedDomains(sites)
 	c.WithTransport(&http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		Dial: (&net.Dialer{
@@ -79,42 +131,62 @@ func CrawlSite(urlSite string, saveto string, config CollyConfig) {
 			config.ResChanel <- CollyResultChan{URL: urlSite, Done: true, Loaded: loadedSize}
 			panic("Exit")
 
-		} else if ext == ".none" {
+		}
+
+		// Keep everything fetched in WARC archive
+		var reqHeader, respHeader http.Header
+		if r.Request.Headers != nil {
+			reqHeader = *r.Request.Headers
+		}
+		if r.Headers != nil {
+			respHeader = *r.Headers
+		}
+		err := config.Archive.WriteExchange("colly", config.Industry, r.Request.URL.String(), reqHeader, r.StatusCode, respHeader, r.Body)
+		if err != nil {
+			config.ResChanel <- CollyResultChan{URL: url, Error: err}
+		}
+
+		if ext == ".none" {
 			return
-		} else if loadedSize > maxLoadSize && !IsExtensionExist(config.Extensions, ext) {
+		} else if maxHTMLSize > 0 && htmlSize >= maxHTMLSize && (ext == ".html" || !IsExtensionExist(config.Extensions, ext)) {
+			// Enough pages of the site are saved, only listed documents are collected further
 			return
 		}
-		filename := EscapeURL(r.Request.URL.EscapedPath())
-		// Some root pages are nameless and will not display at filesystem
-		if filename == "" {
-			filename = "index"
-		}
-		if config.RandomizeName {
-			r.Save(saveto + "/" + filename + randString(6) + ext)
-		} else {
-			r.Save(saveto + "/" + filename + ext)
+		doc := d.Documents{CompanyID: config.CompanyID, Crawler: "colly", URL: r.Request.URL.String()}
+		saved, err := config.Store.Save(doc, r.Body, documentName(saveto, doc.URL, ext), respHeader)
+		if errors.Is(err, errQuotaExceeded) {
+			// Budget is spent, so stop crawling the site
+			config.ResChanel <- CollyResultChan{URL: url, Error: err}
+			config.ResChanel <- CollyResultChan{URL: urlSite, Done: true, Stopped: true, Loaded: loadedSize}
+			panic("Exit")
+		} else if err != nil {
+			config.ResChanel <- CollyResultChan{URL: url, Error: err}
+			return
+		} else if saved == "" {
+			// The same content is already saved for this site
+			return
 		}
 
-		loadedSize += uint(len(r.Body) / 1024)
+		loadedSize += int64(len(r.Body))
+		if ext == ".html" {
+			htmlSize += int64(len(r.Body))
+		}
 		downloaded++
 	})
 
-	c.Visit(url)
-
-	// If it crawled less than 25 Kb - try again, but with `www.` domain
-	if loadedSize < 1024*25 {
-		url = "https://www." + urlSite
+	for _, start := range config.StartURLs {
+		before := loadedSize
+		url = start
 		c.Visit(url)
-	}
 
-	// Also try with HTTP, because some sites do not redirect
-	if loadedSize < 1024*25 {
-		url = "http://" + urlSite
-		c.Visit(url)
-	}
-	if loadedSize < 1024*25 {
-		url = "http://www." + urlSite
-		c.Visit(url)
+		// Site which is not resolved may respond only with `www.` or under HTTP, because it doesn't redirect
+		for _, fallback := range config.Fallbacks[start] {
+			if loadedSize-before >= minSiteLoad {
+				break
+			}
+			url = fallback
+			c.Visit(url)
+		}
 	}
 
 	config.ResChanel <- CollyResultChan{URL: urlSite, Done: true, Loaded: loadedSize}
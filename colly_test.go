@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	d "./db"
+	"./storage"
+)
+
+// siteServer ... Serves main page with links to `pages` HTML pages of `pageSize` bytes and to PDF report
+func siteServer(pages int, pageSize int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			links := []string{}
+			for i := 1; i <= pages; i++ {
+				links = append(links, fmt.Sprintf(`<a href="/page%d.html">Page</a>`, i))
+			}
+			links = append(links, `<a href="/report.pdf">Report</a>`)
+			w.Write([]byte("<html><body>" + strings.Join(links, "") + "</body></html>"))
+		case r.URL.Path == "/report.pdf":
+			w.Write([]byte("%PDF-1.4 annual report"))
+		default:
+			w.Write([]byte("<html><body><p>" + strings.Repeat("a", pageSize) + "</p></body></html>"))
+		}
+	}))
+}
+
+// crawlResults ... Crawls site of company and returns the last result with errors before it
+func crawlResults(memory *d.Memory, store *DocumentStore, server *httptest.Server, maxHTMLLoad uint) (CollyResultChan, []error) {
+	resChan := make(chan CollyResultChan)
+	config := CollyConfig{ResChanel: resChan, MaxFileSize: 1, MaxHTMLLoad: maxHTMLLoad, WorkMinutes: 1, MaxAmount: 100,
+		Extensions: []string{".pdf"}, Store: store, CompanyID: 1, StartURLs: []string{server.URL + "/"}}
+	go CrawlSite(memory.GetCompanies()[0].URL, "colly/Tech/a.com", config)
+	errs := []error{}
+	for r := range resChan {
+		if r.Done {
+			return r, errs
+		}
+		errs = append(errs, r.Error)
+	}
+	return CollyResultChan{}, errs
+}
+
+func TestHTMLLoadLimit(t *testing.T) {
+	server := siteServer(4, 400*1024)
+	defer server.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+
+	// Pages are saved until 1 MB of HTML is loaded, documents are saved after that too
+	result, errs := crawlResults(memory, store, server, 1)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	htmlSize, loaded := int64(0), int64(0)
+	names := []string{}
+	for _, doc := range memory.GetDocuments() {
+		names = append(names, doc.URL[len(server.URL):])
+		loaded += doc.Size
+		if strings.HasSuffix(doc.Path, ".html") {
+			htmlSize += doc.Size
+		}
+	}
+	if want := "/ /page1.html /page2.html /page3.html /report.pdf"; strings.Join(names, " ") != want {
+		t.Fatalf("saved %v, want %v", names, want)
+	}
+	if htmlSize < 1024*1024 || result.Loaded != loaded {
+		t.Fatalf("HTML %v bytes, loaded %v of %v", htmlSize, result.Loaded, loaded)
+	}
+}
+
+func TestSmallSiteLoaded(t *testing.T) {
+	server := siteServer(1, 100)
+	defer server.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+
+	// Site of less than kilobyte is loaded, so it is finished
+	result, _ := crawlResults(memory, store, server, 0)
+	if result.Loaded == 0 || result.Loaded >= 1024 || len(memory.GetDocuments()) != 3 {
+		t.Fatalf("loaded %v bytes, documents %+v", result.Loaded, memory.GetDocuments())
+	}
+}
+
+func TestCollyStoppedByQuota(t *testing.T) {
+	server := siteServer(4, 400*1024)
+	defer server.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	var err error
+	if store.Quota, err = NewQuota(quotaConfig{Company: "1MB"}, memory.GetCompanies(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, errs := crawlResults(memory, store, server, 0)
+	if !result.Stopped || len(errs) != 1 || !errors.Is(errs[0], errQuotaExceeded) {
+		t.Fatalf("result %+v, errors %v", result, errs)
+	}
+	if documents := memory.GetDocuments(); len(documents) != 3 || store.Quota.Left("a.com") == "" {
+		t.Fatalf("documents = %+v", documents)
+	}
+}
+
+func TestAllowedDomains(t *testing.T) {
+	got := allowedDomains([]string{"a.com", "ir.a.com", "https://www.a.com", "http://127.0.0.1:8080/"})
+	want := []string{"s3.amazonaws.com", "a.com", "www.a.com", "sso.a.com", "ir.a.com", "www.ir.a.com", "sso.ir.a.com",
+		"127.0.0.1", "www.127.0.0.1", "sso.127.0.0.1", "127.0.0.1:8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("allowedDomains = %v, want %v", got, want)
+	}
+}
+
+func TestCrawlCompanyDomains(t *testing.T) {
+	foreign := siteServer(1, 100)
+	defer foreign.Close()
+	investors := siteServer(0, 100)
+	defer investors.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><a href="` + investors.URL + `/report.pdf">Report</a>
+			<a href="` + foreign.URL + `/page1.html">Partner</a></body></html>`))
+	}))
+	defer site.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com", Domains: []string{"ir.a.com"}}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+
+	// Every domain of company is crawled into its folder, other sites are not visited
+	resChan := make(chan CollyResultChan)
+	config := CollyConfig{ResChanel: resChan, MaxFileSize: 1, WorkMinutes: 1, MaxAmount: 100, Extensions: []string{".pdf"},
+		Store: store, CompanyID: 1, Domains: []string{"ir.a.com"}, StartURLs: []string{site.URL + "/", investors.URL + "/"}}
+	go CrawlSite("a.com", "colly/Tech/a.com", config)
+	for r := range resChan {
+		if r.Error != nil {
+			t.Error(r.Error)
+		}
+		if r.Done {
+			break
+		}
+	}
+	urls := []string{}
+	for _, doc := range memory.GetDocuments() {
+		urls = append(urls, doc.URL)
+		if !strings.HasPrefix(doc.Path, "colly/Tech/a.com/") || doc.CompanyID != 1 {
+			t.Errorf("document %+v is not saved for company", doc)
+		}
+	}
+	want := []string{site.URL + "/", investors.URL + "/report.pdf", investors.URL + "/"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("crawled %v, want %v", urls, want)
+	}
+}
+
+func TestCrawlFallback(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	small := siteServer(0, 100)
+	defer small.Close()
+	large := siteServer(2, 20*1024)
+	defer large.Close()
+	unused, requests := countingServer(func(w http.ResponseWriter, r *http.Request, attempt int) {
+		w.Write([]byte("<html>Unused</html>"))
+	})
+	defer unused.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+
+	// Other variants are tried until enough is loaded
+	resChan := make(chan CollyResultChan)
+	config := CollyConfig{ResChanel: resChan, MaxFileSize: 1, WorkMinutes: 1, MaxAmount: 100, Extensions: []string{".pdf"},
+		Store: store, CompanyID: 1, StartURLs: []string{down.URL + "/"},
+		Fallbacks: map[string][]string{down.URL + "/": {small.URL, large.URL, unused.URL}}}
+	go CrawlSite("a.com", "colly/Tech/a.com", config)
+	errs := 0
+	for r := range resChan {
+		if r.Error != nil {
+			errs++
+		}
+		if r.Done {
+			break
+		}
+	}
+	hosts := map[string]int{}
+	for _, doc := range memory.GetDocuments() {
+		hosts[strings.SplitN(doc.URL, "/", 4)[2]]++
+	}
+	if errs != 1 || hosts[small.Listener.Addr().String()] != 2 || hosts[large.Listener.Addr().String()] != 4 ||
+		*requests != 0 {
+		t.Fatalf("errors %v, saved from hosts %v, requests to unused variant %v", errs, hosts, *requests)
+	}
+}
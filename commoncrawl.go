@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"./cdx"
+	d "./db"
+)
+
+// Address of the list with all available Common Crawl snapshots
+const commonCollInfo = "https://index.commoncrawl.org/collinfo.json"
+
+// ArchiveResultChan ... result of work of `FetchSnapshots` and `FetchWayback` functions
+type ArchiveResultChan struct {
+	URL      string
+	Progress int
+	Total    int
+	Error    error
+	Done     bool
+	Stopped  bool
+	Skipped  bool
+	Failed   bool
+}
+
+// CommonConfig ... Holds configuration parameters for Common Crawl crawler
+type CommonConfig struct {
+	ResChanel  chan ArchiveResultChan
+	Client     *cdx.Client
+	Snapshots  []string
+	Keep       string
+	Period     string
+	From       string
+	To         string
+	Filters    []string
+	Extensions []string
+	MaxAmount  int
+	Wait       time.Duration
+	Archive    *Archiver
+	Store      *DocumentStore
+	Industry   string
+}
+
+// capture ... Index record together with snapshot it was found in
+type capture struct {
+	cdx.Record
+	Snapshot string
+}
+
+// latestCommonCrawls ... Returns IDs of `amount` most recent Common Crawl snapshots, newest first
+func latestCommonCrawls(amount int, timeout int) ([]string, error) {
+	client := http.Client{Timeout: time.Second * time.Duration(timeout)}
+	resp, err := client.Get(commonCollInfo)
+	if err != nil {
+		return nil, fmt.Errorf("[latestCommonCrawls] error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	collections := []struct {
+		ID string `json:"id"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&collections); err != nil {
+		return nil, fmt.Errorf("[latestCommonCrawls] decode error: %v", err)
+	}
+
+	ids := []string{}
+	for _, c := range collections {
+		ids = append(ids, c.ID)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	if len(ids) > amount {
+		ids = ids[:amount]
+	}
+	return ids, nil
+}
+
+// commonSnapshots ... Returns crawl IDs in order of their priority
+func commonSnapshots(config commonConfig) ([]string, error) {
+	snapshots := config.CrawlDBs
+	if config.Latest > 0 {
+		latest, err := latestCommonCrawls(config.Latest, config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = latest
+	} else if len(snapshots) == 0 && config.CrawlDB != "" {
+		snapshots = []string{config.CrawlDB}
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("[commonSnapshots] no crawl IDs set")
+	}
+	switch config.Keep {
+	case "", "newest", "oldest", "priority":
+	default:
+		return nil, fmt.Errorf("[commonSnapshots] unknown keep rule: %v", config.Keep)
+	}
+	if err := validPeriod(config.Period); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// commonFilters ... Makes filters of CDX index query from configuration
+func commonFilters(config commonConfig) []string {
+	filters := []string{}
+	if config.StatusFilter != "" {
+		filters = append(filters, "~status:"+config.StatusFilter)
+	}
+	if config.MIMEFilter != "" {
+		filters = append(filters, "~mime:"+config.MIMEFilter)
+	}
+	if config.URLFilter != "" {
+		filters = append(filters, "~url:"+config.URLFilter)
+	}
+	return filters
+}
+
+// mergeCaptures ... Leaves one capture per URL. Depending on `keep` the newest, the oldest or
+// the capture from snapshot with higher priority (earlier in the list) is chosen
+func mergeCaptures(snapshots [][]capture, keep string) []capture {
+	chosen := map[string]int{}
+	merged := []capture{}
+	for _, captures := range snapshots {
+		for _, c := range captures {
+			i, found := chosen[c.URL]
+			if !found {
+				chosen[c.URL] = len(merged)
+				merged = append(merged, c)
+			} else if (keep == "" || keep == "newest") && c.Timestamp > merged[i].Timestamp {
+				merged[i] = c
+			} else if keep == "oldest" && c.Timestamp < merged[i].Timestamp {
+				merged[i] = c
+			}
+		}
+	}
+	return merged
+}
+
+// FetchSnapshots ... Searches captures of all sites of company in each snapshot, merges them and saves their content
+func FetchSnapshots(c d.Companies, saveto string, config CommonConfig) {
+	if err := config.Store.Check(c.ID); err != nil {
+		config.ResChanel <- ArchiveResultChan{URL: c.URL, Error: err}
+		config.ResChanel <- ArchiveResultChan{URL: c.URL, Done: true, Stopped: true}
+		return
+	}
+
+	found := [][]capture{}
+	searches, failures := 0, 0
+	for _, snapshot := range config.Snapshots {
+		captures := []capture{}
+		for _, site := range c.Sites() {
+			query := cdx.Query{URL: site, MatchType: "prefix", Filters: config.Filters, From: config.From, To: config.To}
+			records, err := config.Client.Search(snapshot, query)
+			searches++
+			if err != nil {
+				failures++
+				config.ResChanel <- ArchiveResultChan{URL: c.URL, Error: fmt.Errorf("[FetchSnapshots] %v %v: %v", snapshot, site, err)}
+			}
+
+			for _, r := range records {
+				// Skip captures which definitely will not be saved
+				if ext := ExtensionByMIME(r.MIME); ext != ".none" && !IsExtensionExist(config.Extensions, ext) {
+					continue
+				}
+				captures = append(captures, capture{r, snapshot})
+			}
+		}
+		found = append(found, captures)
+	}
+	// Company whose captures are not known is left for the next run
+	if failures > 0 && failures == searches {
+		config.ResChanel <- ArchiveResultChan{URL: c.URL, Done: true, Failed: true}
+		return
+	}
+
+	save := func(capt capture, folder string, period string) error {
+		return saveCapture(c, capt, folder, period, config)
+	}
+	stopped := saveCaptures(c, found, saveto, config.Keep, config.Period, config.MaxAmount, config.Wait, config.ResChanel, save)
+	config.ResChanel <- ArchiveResultChan{URL: c.URL, Done: true, Stopped: stopped}
+}
+
+// saveCapture ... Loads capture from WARC archive and saves its payload if extension is allowed
+func saveCapture(c d.Companies, capt capture, saveto string, period string, config CommonConfig) error {
+	if err := config.Store.Check(c.ID); err != nil {
+		return err
+	}
+	record, err := config.Client.Fetch(capt.Record)
+	if err != nil {
+		return fmt.Errorf("[saveCapture] %v: %v", capt.URL, err)
+	}
+	if err = config.Archive.WriteRecord("common", config.Industry, record); err != nil {
+		return fmt.Errorf("[saveCapture] %v: %v", capt.URL, err)
+	}
+	resp, payload, err := record.HTTPResponse()
+	if err != nil {
+		return fmt.Errorf("[saveCapture] %v: %v", capt.URL, err)
+	}
+
+	capturedAt, _ := capt.Time()
+	doc := d.Documents{CompanyID: c.ID, Crawler: "common", URL: capt.URL, Snapshot: capt.Snapshot,
+		CapturedAt: capturedAt, Period: period}
+	_, err = saveArchived(doc, resp.Header, payload, saveto, config.Extensions, config.Store)
+	return err
+}
+
+// errNotAllowed ... Returned when type of archived payload is not one of collected extensions
+var errNotAllowed = errors.New("extension is not allowed")
+
+// saveArchived ... Saves payload of archived capture if its extension is allowed and records it in documents manifest.
+// Returns path of saved file or empty string for duplicate
+func saveArchived(doc d.Documents, header http.Header, payload []byte, saveto string, extensions []string,
+	store *DocumentStore) (string, error) {
+	ext := ExtensionByContent(payload)
+	if ext == ".none" || !IsExtensionExist(extensions, ext) {
+		return "", fmt.Errorf("[saveArchived] %v: %w: %v", doc.URL, errNotAllowed, ext)
+	}
+
+	filename, err := store.Save(doc, payload, documentName(saveto, doc.URL, ext), header)
+	if err != nil {
+		return "", fmt.Errorf("[saveArchived] %v: %w", doc.URL, err)
+	}
+	return filename, nil
+}
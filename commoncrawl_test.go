@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"./cdx"
+	d "./db"
+	"./storage"
+)
+
+// fetchResults ... Runs `fetch` for company and returns its results up to the last one
+func fetchResults(fetch func(resChan chan ArchiveResultChan)) []ArchiveResultChan {
+	resChan := make(chan ArchiveResultChan)
+	go fetch(resChan)
+	results := []ArchiveResultChan{}
+	for r := range resChan {
+		results = append(results, r)
+		if r.Done {
+			break
+		}
+	}
+	return results
+}
+
+func TestIndexUnavailable(t *testing.T) {
+	// Snapshot CC-DOWN is not available, CC-EMPTY has no captures
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/CC-DOWN") {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"pages": 0}`))
+	}))
+	defer server.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com", Domains: []string{"a.ru"}}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	c := memory.GetCompanies()[0]
+
+	for _, test := range []struct {
+		snapshots []string
+		errors    int
+		failed    bool
+	}{
+		{[]string{"CC-DOWN"}, 2, true},
+		{[]string{"CC-DOWN", "CC-EMPTY"}, 2, false},
+		{[]string{"CC-EMPTY"}, 0, false},
+	} {
+		config := CommonConfig{Client: cdx.NewClient(server.URL, server.URL, time.Second), Snapshots: test.snapshots, Store: store}
+		results := fetchResults(func(resChan chan ArchiveResultChan) {
+			config.ResChanel = resChan
+			FetchSnapshots(c, t.TempDir(), config)
+		})
+		last := results[len(results)-1]
+		if len(results)-1 != test.errors || last.Failed != test.failed || last.Stopped {
+			t.Errorf("snapshots %v: %+v", test.snapshots, results)
+		}
+	}
+}
+
+func TestFailedCompanyNotFinished(t *testing.T) {
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}, {URL: "b.com"}}, nil)
+	m := Miner{db: memory, store: NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)}
+	loop := archiveLoop{Name: "Common", Crawler: d.CrawlerCommon, Path: t.TempDir(), Logger: log.New(ioutil.Discard, "", 0)}
+
+	fetch := func(c d.Companies, saveFolder string, resChan chan ArchiveResultChan) {
+		resChan <- ArchiveResultChan{URL: c.URL, Done: true, Failed: c.URL == "b.com"}
+	}
+	m.archiveCrawl(loop, memory.GetCommon(), fetch, memory.CommonFinished)
+
+	// Failed company is crawled again by the next run
+	if companies := memory.GetCommon(); len(companies) != 1 || companies[0].URL != "b.com" {
+		t.Fatalf("companies left = %+v", companies)
+	}
+	if !memory.Claim(d.CrawlerCommon, "b.com") {
+		t.Fatal("claim of failed company is not released")
+	}
+}
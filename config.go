@@ -2,14 +2,106 @@ package main
 
 // Config ... Holds structure of TOML configuration file
 type Config struct {
-	General generalConfig
-	Common  commonConfig
-	Google  googleConfig
-	Colly   collyConfig
+	General  generalConfig
+	Taxonomy taxonomyConfig
+	Resolver resolverConfig
+	WARC     warcConfig
+	Storage  storageConfig
+	Quota    quotaConfig
+	Balance  balanceConfig
+	Export   exportConfig
+	NearDup  nearDupConfig `toml:"near_duplicates"`
+	Ingest   ingestConfig
+	Common   commonConfig
+	Wayback  waybackConfig
+	Google   googleConfig
+	Colly    collyConfig
 }
 
 type generalConfig struct {
-	Database string
+	Database   string
+	DSN        string
+	Lease      int
+	ClassLevel string `toml:"class_level"`
+}
+
+type taxonomyConfig struct {
+	Name  string
+	Files []string
+}
+
+type resolverConfig struct {
+	Use     bool
+	Workers int
+	Timeout int
+	Refresh bool
+	Debug   bool
+	// Dead ... Liveness statuses of sites which are considered dead
+	Dead []string
+	// DeadSites ... What to do with companies whose sites are dead: `archive` crawls them only from web archives,
+	// `skip` doesn't crawl them at all, `crawl` crawls them like live ones
+	DeadSites string `toml:"dead_sites"`
+}
+
+type storageConfig struct {
+	Backend          string
+	Root             string
+	Endpoint         string
+	Bucket           string
+	Prefix           string
+	Region           string
+	AccessKey        string `toml:"access_key"`
+	SecretKey        string `toml:"secret_key"`
+	ContentAddressed bool   `toml:"content_addressed"`
+	Blobs            string
+}
+
+type quotaConfig struct {
+	Global  string
+	Class   string
+	Company string
+}
+
+type balanceConfig struct {
+	Use       bool
+	Documents int
+	Size      string
+	Classes   map[string]classTargetConfig
+}
+
+type classTargetConfig struct {
+	Documents int
+	Size      string
+}
+
+type exportConfig struct {
+	Use                bool
+	Path               string
+	UniqueOnly         bool   `toml:"unique_only"`
+	DropNearDuplicates bool   `toml:"drop_near_duplicates"`
+	ClassLevel         string `toml:"class_level"`
+	LinkClasses        bool   `toml:"link_classes"`
+}
+
+type nearDupConfig struct {
+	Use       bool
+	Threshold float64
+	Scope     string
+}
+
+type warcConfig struct {
+	Use     bool
+	Path    string
+	MaxSize int `toml:"max_size"`
+}
+
+type ingestConfig struct {
+	Use        bool
+	Path       string
+	Debug      bool
+	Inputs     []string
+	Extensions []string
+	Workers    int
 }
 
 type commonConfig struct {
@@ -21,9 +113,41 @@ type commonConfig struct {
 	//RandomName     bool `toml:"random_name"`
 	//HashFilter     bool `toml:"hash_filter"`
 	Timeout        int
+	SearchInterval int      `toml:"search_interval"`
+	CrawlDB        string   `toml:"crawl_db"`
+	CrawlDBs       []string `toml:"crawl_dbs"`
+	Latest         int
+	Keep           string
+	Period         string
+	From           string
+	To             string
+	StatusFilter   string `toml:"status_filter"`
+	MIMEFilter     string `toml:"mime_filter"`
+	URLFilter      string `toml:"url_filter"`
+	IndexURL       string `toml:"index_url"`
+	DataURL        string `toml:"data_url"`
+	WaitTime       int    `toml:"wait_time"`
+	Workers        int
+}
+
+type waybackConfig struct {
+	Use            bool
+	Path           string
+	Debug          bool
+	Extensions     []string
+	MaxAmount      int `toml:"max_amount"`
+	Timeout        int
+	From           string
+	To             string
+	Keep           string
+	Period         string
+	StatusFilter   string `toml:"status_filter"`
+	MIMEFilter     string `toml:"mime_filter"`
+	Collapse       []string
 	SearchInterval int    `toml:"search_interval"`
-	CrawlDB        string `toml:"crawl_db"`
 	WaitTime       int    `toml:"wait_time"`
+	CDXURL         string `toml:"cdx_url"`
+	WebURL         string `toml:"web_url"`
 	Workers        int
 }
 
@@ -34,6 +158,12 @@ type googleConfig struct {
 	Extension      string
 	SearchInterval int    `toml:"search_interval"`
 	MaxFileSize    uint64 `toml:"max_file_size"`
+	MaxResults     int    `toml:"max_results"`
+	PageInterval   int    `toml:"page_interval"`
+	CacheTTL       int    `toml:"cache_ttl"`
+	ConnectTimeout int    `toml:"connect_timeout"`
+	ReadTimeout    int    `toml:"read_timeout"`
+	Retries        int
 	Workers        int
 	//RandomName     bool `toml:"random_name"`
 }
@@ -48,5 +178,4 @@ type collyConfig struct {
 	MaxHTMLLoad uint `toml:"max_html_load"`
 	WorkMinutes int  `toml:"work_minutes"`
 	Workers     int
-	RandomName  bool `toml:"random_name"`
 }
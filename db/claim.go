@@ -0,0 +1,84 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Crawlers which claim companies before crawling them
+const (
+	CrawlerCommon  = "common"
+	CrawlerWayback = "wayback"
+	CrawlerGoogle  = "google"
+	CrawlerColly   = "colly"
+)
+
+// Columns of companies which mark them as crawled by crawler
+var crawledColumns = map[string]string{
+	CrawlerCommon:  "is_common_crawled",
+	CrawlerWayback: "is_wayback_crawled",
+	CrawlerGoogle:  "is_google_crawled",
+	CrawlerColly:   "is_colly_crawled",
+}
+
+// Lease of company claimed by miner, after which another miner can claim it
+const defaultLease = 6 * time.Hour
+
+var errClaimed = errors.New("company is claimed by another miner")
+
+// minerName ... Returns name of this miner process which owns its claims
+func minerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "miner"
+	}
+	return fmt.Sprintf("%v:%d", host, os.Getpid())
+}
+
+// Claim ... Leases company with URL to this miner for crawler. Returns false if company is already crawled by crawler
+// or claimed by another miner and lease of that miner didn't expire. On PostgreSQL row of company is locked until claim
+// is recorded, miners which claim it at the same time skip it
+func (db *Database) Claim(crawler string, url string) bool {
+	column, found := crawledColumns[crawler]
+	if !found {
+		return false
+	}
+	tx := db.Begin()
+	query := tx.Where("url = ? AND "+column+" = ?", url, false)
+	if db.Dialect().GetName() == DialectPostgres {
+		query = query.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+	}
+	company := Companies{}
+	if err := query.First(&company).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+
+	now := time.Now()
+	claim := Claims{}
+	err := tx.Where("company_id = ? AND crawler = ?", company.ID, crawler).First(&claim).Error
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		err = tx.Create(&Claims{CompanyID: company.ID, Crawler: crawler, ClaimedBy: db.Owner, ClaimedAt: now}).Error
+	case err != nil:
+	case claim.ClaimedBy == db.Owner || now.Sub(claim.ClaimedAt) > db.Lease:
+		err = tx.Model(&claim).UpdateColumns(map[string]interface{}{"claimed_by": db.Owner, "claimed_at": now}).Error
+	default:
+		err = errClaimed
+	}
+	if err != nil {
+		tx.Rollback()
+		return false
+	}
+	return tx.Commit().Error == nil
+}
+
+// Release ... Gives up claim of company with URL for crawler, so other miners can crawl it, e.g. after failure
+func (db *Database) Release(crawler string, url string) {
+	db.Where("crawler = ? AND claimed_by = ? AND company_id IN (SELECT id FROM companies WHERE url = ?)",
+		crawler, db.Owner, url).Delete(&Claims{})
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DedupReport ... Amount of files and bytes saved by keeping repeated documents only once
+type DedupReport struct {
+	Files       int
+	Bytes       int64
+	UniqueFiles int
+	UniqueBytes int64
+}
+
+// Tables of taxonomy levels and columns of companies which refer to them by ID
+var taxonomyLevels = []struct{ table, column string }{
+	{"industries", "industry_id"}, {"industry_groups", "industry_group_id"}, {"businesses", "business_id"}, {"economics", "economic_id"}}
+
+// countColumn ... Returns counter which document is counted in: HTML pages and other documents are counted apart
+func countColumn(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), ".html") {
+		return "num_html"
+	}
+	return "num_docs"
+}
+
+// AddDocument ... Records collected file in documents manifest and counts it for its company and classes
+func (db *Database) AddDocument(doc *Documents) error {
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = time.Now()
+	}
+	tx := db.Begin()
+	if err := tx.Create(doc).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	column := countColumn(doc.Path)
+	counter := gorm.Expr("COALESCE(" + column + ", 0) + 1")
+	if err := tx.Model(&Companies{}).Where("id = ?", doc.CompanyID).UpdateColumn(column, counter).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, level := range taxonomyLevels {
+		err := tx.Table(level.table).Where("id = (SELECT "+level.column+" FROM companies WHERE id = ?)", doc.CompanyID).
+			UpdateColumn(column, counter).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// RefreshCounts ... Recounts companies and documents of each company and class from documents manifest
+func (db *Database) RefreshCounts() error {
+	err := db.Exec(`UPDATE companies SET
+		num_html = (SELECT COUNT(*) FROM documents WHERE company_id = companies.id AND LOWER(path) LIKE '%.html'),
+		num_docs = (SELECT COUNT(*) FROM documents WHERE company_id = companies.id AND LOWER(path) NOT LIKE '%.html')`).Error
+	if err != nil {
+		return err
+	}
+	for _, level := range taxonomyLevels {
+		match := "companies." + level.column + " = " + level.table + ".id"
+		err = db.Exec("UPDATE " + level.table + " SET" +
+			" num_url = (SELECT COUNT(*) FROM companies WHERE " + match + ")," +
+			" num_html = (SELECT COALESCE(SUM(num_html), 0) FROM companies WHERE " + match + ")," +
+			" num_docs = (SELECT COALESCE(SUM(num_docs), 0) FROM companies WHERE " + match + ")").Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDocuments ... Returns all documents of manifest in order they were collected
+func (db *Database) GetDocuments() []Documents {
+	documents := []Documents{}
+	db.Order("id").Find(&documents)
+	return documents
+}
+
+// DocumentTotal ... Amount and size of documents collected for company
+type DocumentTotal struct {
+	Files int
+	Bytes int64
+}
+
+// DocumentTotals ... Returns amount and size of collected documents of each company
+func (db *Database) DocumentTotals() map[int]DocumentTotal {
+	totals := map[int]DocumentTotal{}
+	rows, err := db.Raw("SELECT company_id, COUNT(*), COALESCE(SUM(size), 0) FROM documents GROUP BY company_id").Rows()
+	if err != nil {
+		return totals
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var total DocumentTotal
+		if rows.Scan(&id, &total.Files, &total.Bytes) == nil {
+			totals[id] = total
+		}
+	}
+	return totals
+}
+
+// ClearDuplicates ... Removes near-duplicate marks from all documents
+func (db *Database) ClearDuplicates() error {
+	return db.Model(&Documents{}).Where("duplicate_of IS NOT NULL").Update("duplicate_of", gorm.Expr("NULL")).Error
+}
+
+// MarkDuplicate ... Marks document as near-duplicate of another one
+func (db *Database) MarkDuplicate(id int, of int) error {
+	return db.Model(&Documents{}).Where("id = ?", id).Update("duplicate_of", of).Error
+}
+
+// HasDocument ... Checks whether document with the same content is already saved in the folder
+func (db *Database) HasDocument(hash string, folder string) bool {
+	count := 0
+	prefix := strings.TrimSuffix(folder, "/") + "/"
+	db.Model(&Documents{}).Where("hash = ? AND substr(path, 1, ?) = ?", hash, len(prefix), prefix).Count(&count)
+	return count > 0
+}
+
+// DedupStats ... Compares amount of all collected documents with amount of unique ones
+func (db *Database) DedupStats() DedupReport {
+	report := DedupReport{}
+	row := db.Raw("SELECT COUNT(*), COALESCE(SUM(size), 0) FROM documents").Row()
+	row.Scan(&report.Files, &report.Bytes)
+
+	// Documents recorded without hash are counted as unique
+	row = db.Raw(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM (
+		SELECT MAX(size) AS size FROM documents WHERE COALESCE(hash, '') != '' GROUP BY hash
+		UNION ALL SELECT size FROM documents WHERE COALESCE(hash, '') = '') AS u`).Row()
+	row.Scan(&report.UniqueFiles, &report.UniqueBytes)
+	return report
+}
+
+// PrintDedup ... Prints how many files and bytes are repeated in collected documents
+func (db *Database) PrintDedup() {
+	r := db.DedupStats()
+	fmt.Printf("Documents: %v (%.1f MB), unique: %v (%.1f MB), duplicates: %v (%.1f MB)\n",
+		r.Files, float64(r.Bytes)/1024/1024, r.UniqueFiles, float64(r.UniqueBytes)/1024/1024,
+		r.Files-r.UniqueFiles, float64(r.Bytes-r.UniqueBytes)/1024/1024)
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// NormalizeDomain ... Returns canonical form of site: lower case ASCII domain, where international names are
+// converted to punycode, without scheme, `www.`, port, path and trailing slashes or dots
+func NormalizeDomain(site string) (string, error) {
+	domain := strings.TrimSpace(site)
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+	if i := strings.IndexAny(domain, "/?#"); i >= 0 {
+		domain = domain[:i]
+	}
+	if i := strings.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return "", fmt.Errorf("[NormalizeDomain] %v: %v", site, err)
+	}
+	domain = strings.TrimPrefix(domain, "www.")
+	if domain == "" {
+		return "", fmt.Errorf("[NormalizeDomain] %v: no domain", site)
+	}
+	return domain, nil
+}
+
+// RegistrableDomain ... Returns domain under public suffix which is registered by owner of site, e.g. `example.co.uk`
+// for `shop.example.co.uk`. Domain itself is returned if it has no public suffix, e.g. IP address or `localhost`
+func RegistrableDomain(domain string) string {
+	if net.ParseIP(domain) != nil {
+		return domain
+	}
+	if registrable, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		return registrable
+	}
+	return domain
+}
+
+// NormalizeCompanies ... Converts URLs of companies and their domains into canonical form. Company whose canonical
+// URL belongs to another company is merged into it, domain which is already known is deleted. Site which can't be
+// normalized is left as is. Returns amount of changed sites
+func (db *Database) NormalizeCompanies() (int, error) {
+	changed := 0
+	companies := []Companies{}
+	if err := db.Find(&companies).Error; err != nil {
+		return 0, fmt.Errorf("[NormalizeCompanies] error: %v", err)
+	}
+	for _, c := range companies {
+		domain, err := NormalizeDomain(c.URL)
+		if err != nil {
+			log.Println(err)
+			continue
+		} else if domain == c.URL {
+			continue
+		}
+		existing := Companies{}
+		if db.Where("url = ?", domain).First(&existing).RecordNotFound() {
+			err = db.Model(&Companies{}).Where("id = ?", c.ID).UpdateColumn("url", domain).Error
+		} else {
+			log.Printf("[NormalizeCompanies] %v is merged into company %v\n", c.URL, domain)
+			err = db.mergeCompany(c, existing)
+		}
+		if err != nil {
+			return changed, fmt.Errorf("[NormalizeCompanies] %v: %v", c.URL, err)
+		}
+		changed++
+	}
+
+	domains := []CompanyDomains{}
+	if err := db.Find(&domains).Error; err != nil {
+		return changed, fmt.Errorf("[NormalizeCompanies] error: %v", err)
+	}
+	for _, row := range domains {
+		domain, err := NormalizeDomain(row.Domain)
+		if err != nil {
+			log.Println(err)
+			continue
+		} else if domain == row.Domain {
+			continue
+		}
+		count, urls := 0, 0
+		db.Model(&CompanyDomains{}).Where("domain = ?", domain).Count(&count)
+		db.Model(&Companies{}).Where("url = ?", domain).Count(&urls)
+		if count > 0 || urls > 0 {
+			log.Printf("[NormalizeCompanies] %v: %v is already known\n", row.Domain, domain)
+			err = db.Delete(&CompanyDomains{}, "id = ?", row.ID).Error
+		} else {
+			err = db.Model(&CompanyDomains{}).Where("id = ?", row.ID).UpdateColumn("domain", domain).Error
+		}
+		if err != nil {
+			return changed, fmt.Errorf("[NormalizeCompanies] error: %v", err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// mergeCompany ... Moves documents, domains and classes of duplicate company to company `into` and deletes
+// duplicate. Class of duplicate becomes additional class of that company if it differs. Site crawled for any
+// of companies stays crawled, and amounts of their documents are summed
+func (db *Database) mergeCompany(duplicate Companies, into Companies) error {
+	count := func(n *uint) uint {
+		if n == nil {
+			return 0
+		}
+		return *n
+	}
+	state := map[string]interface{}{
+		"is_common_crawled":  into.IsCommonCrawled || duplicate.IsCommonCrawled,
+		"is_google_crawled":  into.IsGoogleCrawled || duplicate.IsGoogleCrawled,
+		"is_colly_crawled":   into.IsCollyCrawled || duplicate.IsCollyCrawled,
+		"is_wayback_crawled": into.IsWaybackCrawled || duplicate.IsWaybackCrawled,
+		"num_docs":           count(into.NumDocs) + count(duplicate.NumDocs),
+		"num_html":           count(into.NumHTML) + count(duplicate.NumHTML),
+	}
+
+	tx := db.Begin()
+	if err := tx.Model(&Companies{}).Where("id = ?", into.ID).UpdateColumns(state).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, table := range []interface{}{&Documents{}, &CompanyDomains{}, &CompanyClasses{}} {
+		if err := tx.Model(table).Where("company_id = ?", duplicate.ID).UpdateColumn("company_id", into.ID).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if !sameClass(duplicate, into) {
+		class := CompanyClasses{CompanyID: into.ID, IndustryID: duplicate.IndustryID, IndustryGroupID: duplicate.IndustryGroupID,
+			BusinessID: duplicate.BusinessID, EconomicID: duplicate.EconomicID}
+		if err := tx.Create(&class).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Delete(&Companies{}, "id = ?", duplicate.ID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// sameClass ... Checks whether class of company `c` is unknown or the same as class of company `other`
+func sameClass(c Companies, other Companies) bool {
+	same := func(a *int, b *int) bool {
+		return a == nil || b != nil && *a == *b
+	}
+	if c.IndustryID == nil && c.IndustryGroupID == nil && c.BusinessID == nil && c.EconomicID == nil {
+		return true
+	}
+	return same(c.IndustryID, other.IndustryID) && same(c.IndustryGroupID, other.IndustryGroupID) &&
+		same(c.BusinessID, other.BusinessID) && same(c.EconomicID, other.EconomicID)
+}
+
+// Liveness of sites found by check before crawling
+const (
+	LivenessLive        = "live"
+	LivenessRedirected  = "redirected"
+	LivenessParked      = "parked"
+	LivenessHTTPError   = "http_error"
+	LivenessTLSError    = "tls_error"
+	LivenessRefused     = "connection_refused"
+	LivenessDNSFailure  = "dns_failure"
+	LivenessUnreachable = "unreachable"
+)
+
+// SetChecked ... Records liveness of site of company, scheme and host under which it responds and URL to which
+// it redirects. Site is URL of company or one of its additional domains
+func (db *Database) SetChecked(companyID int, site string, liveness string, scheme string, host string, location string) error {
+	values := map[string]interface{}{"liveness": liveness, "scheme": scheme, "host": host, "location": location,
+		"checked_at": time.Now()}
+	err := db.Model(&Companies{}).Where("id = ? AND url = ?", companyID, site).UpdateColumns(values).Error
+	if err == nil {
+		err = db.Model(&CompanyDomains{}).Where("company_id = ? AND domain = ?", companyID, site).UpdateColumns(values).Error
+	}
+	if err != nil {
+		return fmt.Errorf("[SetChecked] error: %v", err)
+	}
+	return nil
+}
+
+// Kind of additional domain which is found by redirect from site of company, e.g. after rebranding
+const DomainRedirect = "redirect"
+
+// AddDomain ... Adds additional domain of company unless domain is already known as site of some company.
+// Returns whether domain was added
+func (db *Database) AddDomain(companyID int, domain string, kind string) (bool, error) {
+	count := 0
+	if err := db.Model(&Companies{}).Where("url = ?", domain).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("[AddDomain] error: %v", err)
+	} else if count > 0 {
+		return false, nil
+	}
+	if err := db.Model(&CompanyDomains{}).Where("domain = ?", domain).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("[AddDomain] error: %v", err)
+	} else if count > 0 {
+		return false, nil
+	}
+	if err := db.Create(&CompanyDomains{CompanyID: companyID, Domain: domain, Kind: kind}).Error; err != nil {
+		return false, fmt.Errorf("[AddDomain] error: %v", err)
+	}
+	return true, nil
+}
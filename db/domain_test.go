@@ -0,0 +1,137 @@
+package db
+
+import "testing"
+
+func TestNormalizeMergesDuplicates(t *testing.T) {
+	forEachDatabase(t, testNormalizeMergesDuplicates)
+}
+
+func testNormalizeMergesDuplicates(t *testing.T, db *Database) {
+	industry, other := Industries{Industry: "Telecom"}, Industries{Industry: "Media"}
+	db.Create(&industry)
+	db.Create(&other)
+	docs, html, duplicateDocs := uint(3), uint(2), uint(4)
+	canonical := Companies{URL: "tattelecom.ru", IndustryID: &industry.ID, IsCommonCrawled: true, NumDocs: &docs,
+		NumHTML: &html}
+	duplicate := Companies{URL: "https://tattelecom.ru/", IndustryID: &other.ID, IsCollyCrawled: true,
+		IsWaybackCrawled: true, NumDocs: &duplicateDocs}
+	db.Create(&canonical)
+	db.Create(&duplicate)
+	db.Create(&CompanyDomains{CompanyID: duplicate.ID, Domain: "http://www.ir.tattelecom.ru/"})
+	db.Create(&CompanyDomains{CompanyID: canonical.ID, Domain: "WWW.TATTELECOM.RU"})
+	if err := db.AddDocument(&Documents{CompanyID: duplicate.ID, Crawler: "colly", Path: "a/index.html"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.NormalizeCompanies(); err != nil {
+		t.Fatal(err)
+	}
+	companies := []Companies{}
+	db.Find(&companies)
+	if len(companies) != 1 || companies[0].ID != canonical.ID || companies[0].URL != "tattelecom.ru" {
+		t.Fatalf("companies = %+v", companies)
+	}
+	// Crawled state of both companies is kept, page of duplicate is counted
+	merged := companies[0]
+	if !merged.IsCommonCrawled || !merged.IsCollyCrawled || !merged.IsWaybackCrawled || merged.IsGoogleCrawled ||
+		*merged.NumDocs != 7 || *merged.NumHTML != 3 {
+		t.Fatalf("merged company = %+v", merged)
+	}
+	domains := []CompanyDomains{}
+	db.Find(&domains)
+	if len(domains) != 1 || domains[0].Domain != "ir.tattelecom.ru" || domains[0].CompanyID != canonical.ID {
+		t.Fatalf("domains = %+v", domains)
+	}
+	documents := []Documents{}
+	db.Find(&documents)
+	if len(documents) != 1 || documents[0].CompanyID != canonical.ID {
+		t.Fatalf("documents = %+v", documents)
+	}
+	classes := []CompanyClasses{}
+	db.Find(&classes)
+	if len(classes) != 1 || classes[0].CompanyID != canonical.ID || *classes[0].IndustryID != other.ID {
+		t.Fatalf("classes = %+v", classes)
+	}
+}
+
+func TestCompanyDomains(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		holding, bank := Companies{URL: "a.com"}, Companies{URL: "b.com"}
+		db.Create(&holding)
+		db.Create(&bank)
+		for _, test := range []struct {
+			companyID int
+			domain    string
+			added     bool
+		}{
+			{holding.ID, "ir.a.com", true},
+			{holding.ID, "a.ru", true},
+			{bank.ID, "a.ru", false},
+			{holding.ID, "b.com", false},
+		} {
+			if added, err := db.AddDomain(test.companyID, test.domain, DomainRedirect); err != nil || added != test.added {
+				t.Errorf("AddDomain(%v, %v) = %v, %v", test.companyID, test.domain, added, err)
+			}
+		}
+
+		// Domains of company are crawled in order they were added after its URL
+		sites := map[string][]string{}
+		for _, c := range db.GetCompanies() {
+			sites[c.URL] = c.Sites()
+		}
+		if s := sites["a.com"]; len(s) != 3 || s[0] != "a.com" || s[1] != "ir.a.com" || s[2] != "a.ru" {
+			t.Errorf("sites of holding = %v", s)
+		}
+		if s := sites["b.com"]; len(s) != 1 || s[0] != "b.com" {
+			t.Errorf("sites of bank = %v", s)
+		}
+	})
+}
+
+func TestSetChecked(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		c := Companies{URL: "a.com"}
+		db.Create(&c)
+		for _, domain := range []string{"a.ru", "ir.a.com"} {
+			if _, err := db.AddDomain(c.ID, domain, DomainRedirect); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checks := []struct {
+			site, liveness, scheme, host, location string
+		}{
+			{"a.com", LivenessRedirected, "https", "a.com", "https://b.com/"},
+			{"a.ru", LivenessParked, "http", "www.a.ru", ""},
+		}
+		for _, check := range checks {
+			if err := db.SetChecked(c.ID, check.site, check.liveness, check.scheme, check.host, check.location); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Unchecked site is neither resolved nor dead
+		companies := db.GetCompanies()
+		if len(companies) != 1 {
+			t.Fatalf("companies = %+v", companies)
+		}
+		got := companies[0]
+		if got.Liveness != LivenessRedirected || got.CheckedAt == nil || got.Checked["a.ru"] != LivenessParked ||
+			got.Moved["a.com"] != "https://b.com/" || got.Resolved["a.ru"] != "http://www.a.ru" || len(got.Checked) != 2 {
+			t.Fatalf("company = %+v", got)
+		}
+		if _, found := got.Resolved["ir.a.com"]; found || got.StartURL("ir.a.com") != "https://ir.a.com" {
+			t.Errorf("unchecked site is resolved: %+v", got.Resolved)
+		}
+		dead := map[string]bool{LivenessRedirected: true, LivenessParked: true}
+		if got.Dead(dead) {
+			t.Error("company with unchecked site is dead")
+		}
+		if err := db.SetChecked(c.ID, "ir.a.com", LivenessDNSFailure, "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+		dead[LivenessDNSFailure] = true
+		if !db.GetCompanies()[0].Dead(dead) {
+			t.Error("company with all sites dead is alive")
+		}
+	})
+}
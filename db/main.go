@@ -3,31 +3,74 @@ package db
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 // Database ... Contains methods to work with data
 type Database struct {
 	*gorm.DB
+	// ClassLevel ... Level of taxonomy, labels of which are used as classes of companies
+	ClassLevel string
+	// Owner ... Name of miner which claims companies, host and process ID by default
+	Owner string
+	// Lease ... Time after which company claimed by another miner can be claimed again
+	Lease time.Duration
+	// taxonomyID ... Taxonomy classes of which are used, 0 means all taxonomies
+	taxonomyID int
 	//busyCrawlIDs  []int
 	//busyCollyIDs  []int
 	//busyGoogleIDs []int
 }
 
-// OpenInitialize ... Open connection to DB and Initializes custom structure. Connection needs to be closed
-func (db *Database) OpenInitialize(path string) {
-	gdb, err := gorm.Open("sqlite3", path)
+// Dialects of supported databases
+const (
+	DialectSQLite   = "sqlite3"
+	DialectPostgres = "postgres"
+)
+
+// OpenInitialize ... Open connection to DB and Initializes custom structure. Source is path of SQLite database
+// or connection string of PostgreSQL one, which lets several miners share companies and documents. Connection
+// needs to be closed
+func (db *Database) OpenInitialize(dialect string, source string) {
+	if dialect != DialectSQLite && dialect != DialectPostgres {
+		log.Fatalln("unknown database dialect: ", dialect)
+	}
+	gdb, err := gorm.Open(dialect, source)
 	if err != nil {
 		log.Fatalln("failed to connect database: ", err)
 	}
 	//defer gdb.Close()
-	gdb.Exec("PRAGMA foreign_keys = ON;")
+	if dialect == DialectSQLite {
+		// SQLite has only one writer and pragmas are set per connection, so the only connection is used
+		gdb.DB().SetMaxOpenConns(1)
+		gdb.Exec("PRAGMA foreign_keys = ON;")
+	}
 	gdb.SingularTable(true)
 	gdb.LogMode(false)
-	gdb.AutoMigrate(&Economics{}, &Businesses{}, &IndustryGroups{}, &Industries{}, &Companies{})
+	if err = migrateLegacy(gdb); err != nil {
+		log.Fatalln("failed to migrate database: ", err)
+	}
+	gdb.AutoMigrate(&Taxonomies{}, &Economics{}, &Businesses{}, &IndustryGroups{}, &Industries{}, &Companies{},
+		&CompanyClasses{}, &CompanyDomains{}, &Documents{}, &SearchQueries{}, &SearchResults{}, &Claims{})
 	db.DB = gdb
+	db.ClassLevel = LevelGroup
+	if db.Owner == "" {
+		db.Owner = minerName()
+	}
+	if db.Lease == 0 {
+		db.Lease = defaultLease
+	}
+	if err = db.ResolveCompanies(); err != nil {
+		log.Fatalln("failed to resolve classes of companies: ", err)
+	}
+	// Sites are kept in one canonical form, so they are not duplicated and crawlers can build URLs from them
+	if _, err = db.NormalizeCompanies(); err != nil {
+		log.Fatalln("failed to normalize sites of companies: ", err)
+	}
 
 	// Exclude 0 indexes, since they always have empty values in SQLite
 	//db.busyCollyIDs = []int{0}
@@ -37,21 +80,45 @@ func (db *Database) OpenInitialize(path string) {
 
 // PrintInfo ... Prints basic info about items in database
 func (db *Database) PrintInfo() {
-	industries := []Industries{}
-	db.DB.Find(&industries)
-	fmt.Println("Industries in DB: ", len(industries))
+	taxonomies, economics, businesses, groups, industries := 0, 0, 0, 0, 0
+	db.Model(&Taxonomies{}).Count(&taxonomies)
+	db.Model(&Economics{}).Count(&economics)
+	db.Model(&Businesses{}).Count(&businesses)
+	db.Model(&IndustryGroups{}).Count(&groups)
+	db.Model(&Industries{}).Count(&industries)
+	fmt.Println("Taxonomies in DB: ", taxonomies)
+	fmt.Println("Economic sectors in DB: ", economics)
+	fmt.Println("Business sectors in DB: ", businesses)
+	fmt.Println("Industry groups in DB: ", groups)
+	fmt.Println("Industries in DB: ", industries)
 
 	companies := []Companies{}
 	db.Find(&companies)
 	fmt.Println("Companies in DB: ", len(companies))
+	multiLabel := 0
+	db.Model(&CompanyClasses{}).Select("COUNT(DISTINCT company_id)").Row().Scan(&multiLabel)
+	fmt.Println("Companies with several classes: ", multiLabel)
+	domains := 0
+	db.Model(&CompanyDomains{}).Count(&domains)
+	fmt.Println("Additional domains of companies: ", domains)
 
 	fmt.Println("Not crawled:")
 	common := db.GetCommon()
 	fmt.Println(" Common crawl: ", len(common))
+	wayback := db.GetWayback()
+	fmt.Println(" Wayback Machine: ", len(wayback))
 	google := db.GetGoogle()
 	fmt.Println(" Google filter: ", len(google))
 	colly := db.GetColly()
 	fmt.Println(" Colly crawler: ", len(colly))
+
+	documents := 0
+	db.Model(&Documents{}).Count(&documents)
+	fmt.Println("Documents collected: ", documents)
+
+	searches := 0
+	db.Model(&SearchQueries{}).Count(&searches)
+	fmt.Println("Cached searches: ", searches)
 }
 
 /*
@@ -67,10 +134,57 @@ func (db *Database) GetCollyURL() (string, error) {
 }
 */
 
+// loadDomains ... Sets additional domains of companies, resolved base URLs and liveness of their sites
+func (db *Database) loadDomains(companies []Companies) []Companies {
+	index := map[int]int{}
+	for i, c := range companies {
+		index[c.ID] = i
+		companies[i].Resolved = map[string]string{}
+		companies[i].Checked = map[string]string{}
+		companies[i].Moved = map[string]string{}
+		if c.Host != "" {
+			companies[i].Resolved[c.URL] = c.Scheme + "://" + c.Host
+		}
+		if c.CheckedAt != nil {
+			companies[i].Checked[c.URL] = c.Liveness
+		}
+		if c.Location != "" {
+			companies[i].Moved[c.URL] = c.Location
+		}
+	}
+
+	rows := []CompanyDomains{}
+	db.Order("id").Find(&rows)
+	for _, r := range rows {
+		i, found := index[r.CompanyID]
+		if !found {
+			continue
+		}
+		companies[i].Domains = append(companies[i].Domains, r.Domain)
+		if r.Host != "" {
+			companies[i].Resolved[r.Domain] = r.Scheme + "://" + r.Host
+		}
+		if r.CheckedAt != nil {
+			companies[i].Checked[r.Domain] = r.Liveness
+		}
+		if r.Location != "" {
+			companies[i].Moved[r.Domain] = r.Location
+		}
+	}
+	return companies
+}
+
+// GetCompanies ... Returns all companies
+func (db *Database) GetCompanies() []Companies {
+	companies := []Companies{}
+	db.Find(&companies)
+	return db.classify(db.loadDomains(companies))
+}
+
 func (db *Database) GetCommon() []Companies {
 	companies := []Companies{}
-	db.Where("is_common_crawled != 1").Find(&companies)
-	return companies
+	db.Where("is_common_crawled = ?", false).Find(&companies)
+	return db.classify(db.loadDomains(companies))
 }
 
 func (db *Database) CommonFinished(url string) {
@@ -78,12 +192,27 @@ func (db *Database) CommonFinished(url string) {
 	db.Model(&company).Where("url = ?", url).Update("is_common_crawled", true)
 	company.IsCommonCrawled = true
 	db.Save(&company)
+	db.Release(CrawlerCommon, url)
+}
+
+func (db *Database) GetWayback() []Companies {
+	companies := []Companies{}
+	db.Where("is_wayback_crawled = ?", false).Find(&companies)
+	return db.classify(db.loadDomains(companies))
+}
+
+func (db *Database) WaybackFinished(url string) {
+	company := Companies{URL: url}
+	db.Model(&company).Where("url = ?", url).Update("is_wayback_crawled", true)
+	company.IsWaybackCrawled = true
+	db.Save(&company)
+	db.Release(CrawlerWayback, url)
 }
 
 func (db *Database) GetGoogle() []Companies {
 	companies := []Companies{}
-	db.Where("is_google_crawled != 1").Find(&companies)
-	return companies
+	db.Where("is_google_crawled = ?", false).Find(&companies)
+	return db.classify(db.loadDomains(companies))
 }
 
 func (db *Database) GoogleFinished(url string) {
@@ -91,12 +220,13 @@ func (db *Database) GoogleFinished(url string) {
 	db.Model(&company).Where("url = ?", url).Update("is_google_crawled", true)
 	company.IsGoogleCrawled = true
 	db.Save(&company)
+	db.Release(CrawlerGoogle, url)
 }
 
 func (db *Database) GetColly() []Companies {
 	companies := []Companies{}
-	db.Where("is_colly_crawled != 1").Find(&companies)
-	return companies
+	db.Where("is_colly_crawled = ?", false).Find(&companies)
+	return db.classify(db.loadDomains(companies))
 }
 
 func (db *Database) CollyFinished(url string) {
@@ -104,29 +234,45 @@ func (db *Database) CollyFinished(url string) {
 	db.Model(&company).Where("url = ?", url).Update("is_colly_crawled", true)
 	company.IsCollyCrawled = true
 	db.Save(&company)
+	db.Release(CrawlerColly, url)
 }
 
 func (db *Database) fillToDebug() {
-	testIndustr := []Industries{
-		Industries{Industry: "Internet Services"},
-		Industries{Industry: "Software Developement"},
-		Industries{Industry: "Education"},
-		Industries{Industry: "Retail"},
+	economic := Economics{Economics: "Technology"}
+	db.Create(&economic)
+	business := Businesses{Businesses: "Technology", EconomicID: &economic.ID}
+	db.Create(&business)
+	groups := map[string]*IndustryGroups{
+		"Software & IT Services":          &IndustryGroups{IndustryGroups: "Software & IT Services", BusinessID: &business.ID},
+		"Telecommunications Services":     &IndustryGroups{IndustryGroups: "Telecommunications Services"},
+		"Academic & Educational Services": &IndustryGroups{IndustryGroups: "Academic & Educational Services"},
+		"Food & Drug Retailing":           &IndustryGroups{IndustryGroups: "Food & Drug Retailing"},
+	}
+	for _, g := range groups {
+		db.Create(g)
 	}
 
-	for _, ind := range testIndustr {
-		db.Create(&ind)
+	testIndustr := []Industries{
+		Industries{Industry: "Internet Services", IndustryGroupID: &groups["Telecommunications Services"].ID},
+		Industries{Industry: "Software Developement", IndustryGroupID: &groups["Software & IT Services"].ID},
+		Industries{Industry: "Education", IndustryGroupID: &groups["Academic & Educational Services"].ID},
+		Industries{Industry: "Retail", IndustryGroupID: &groups["Food & Drug Retailing"].ID},
+	}
+	industries := map[string]*int{}
+	for i := range testIndustr {
+		db.Create(&testIndustr[i])
+		industries[testIndustr[i].Industry] = &testIndustr[i].ID
 	}
 
 	testCompanies := []Companies{
-		Companies{URL: "https://domru.ru", Industry: "Internet Services"},
-		Companies{URL: "https://innopolis.ru", Industry: "Education"},
-		Companies{URL: "https://tattelecom.ru/", Industry: "Internet Services"},
-		Companies{URL: "https://www.wikipedia.org", Industry: "Education"},
-		Companies{URL: "https://kai.ru", Industry: "Education"},
-		Companies{URL: "https://www.acronis.com", Industry: "Software Developement"},
-		Companies{URL: "https://www.kaspersky.ru", Industry: "Software Developement"},
-		Companies{URL: "http://pivoman-kazan.ru", Industry: "Retail"},
+		Companies{URL: "domru.ru", IndustryID: industries["Internet Services"]},
+		Companies{URL: "innopolis.ru", IndustryID: industries["Education"]},
+		Companies{URL: "tattelecom.ru", IndustryID: industries["Internet Services"]},
+		Companies{URL: "wikipedia.org", IndustryID: industries["Education"]},
+		Companies{URL: "kai.ru", IndustryID: industries["Education"]},
+		Companies{URL: "acronis.com", IndustryID: industries["Software Developement"]},
+		Companies{URL: "kaspersky.ru", IndustryID: industries["Software Developement"]},
+		Companies{URL: "pivoman-kazan.ru", IndustryID: industries["Retail"]},
 	}
 	for _, comp := range testCompanies {
 		isPossible := db.NewRecord(&comp)
@@ -135,33 +281,23 @@ func (db *Database) fillToDebug() {
 		}
 		db.Create(&comp)
 	}
+	db.ResolveCompanies()
 }
 
-// GetIndustriesFolders ... Returns folders of industry categories, folders of which should be created
+// GetIndustriesFolders ... Returns folders of classes at class level, folders of which should be created
 func (db *Database) GetIndustriesFolders() []string {
-	folders := []string{}
-	companies := []Companies{}
-
-	// Get all companies that have Industry Group and make a set of these group names
-	db.Where("industry_groups != 0").Find(&companies)
-	industryGroupSet := map[string]struct{}{}
-	for _, c := range companies {
-		industryGroupSet[c.IndustryGroups] = struct{}{}
-	}
+	return classFolders(db.GetCompanies())
+}
 
-	// Get all companies that have Industry and do not have Industry group, then make a set of these industry names
-	db.Where("industry != 0 and industry_groups is NULL").Find(&companies)
-	industrySet := map[string]struct{}{}
+// classFolders ... Returns distinct classes of companies
+func classFolders(companies []Companies) []string {
+	folders := []string{}
+	set := map[string]struct{}{}
 	for _, c := range companies {
-		industrySet[c.Industry] = struct{}{}
-	}
-
-	// Join the 2 sets
-	for ig := range industryGroupSet {
-		folders = append(folders, ig)
-	}
-	for i := range industrySet {
-		folders = append(folders, i)
+		if _, found := set[c.Class]; c.Class != "" && !found {
+			set[c.Class] = struct{}{}
+			folders = append(folders, c.Class)
+		}
 	}
 	return folders
 }
@@ -169,7 +305,7 @@ func (db *Database) GetIndustriesFolders() []string {
 func main() {
 	//os.Remove("test.db")
 	db := Database{}
-	db.OpenInitialize("test.db")
+	db.OpenInitialize(DialectSQLite, "test.db")
 	db.fillToDebug()
 
 	db.PrintInfo()
@@ -0,0 +1,283 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Environment variable with connection string of PostgreSQL database for tests, its tables are dropped
+const testDSNVariable = "MINER_TEST_DSN"
+
+// Environment variable which is set by CI, where PostgreSQL tests must not be skipped
+const ciVariable = "CI"
+
+// forEachDatabase ... Runs test with empty SQLite database and with PostgreSQL one if it is configured
+func forEachDatabase(t *testing.T, test func(t *testing.T, db *Database)) {
+	t.Run(DialectSQLite, func(t *testing.T) {
+		db := &Database{}
+		db.OpenInitialize(DialectSQLite, filepath.Join(t.TempDir(), "test.db"))
+		defer db.Close()
+		test(t, db)
+	})
+	t.Run(DialectPostgres, func(t *testing.T) {
+		dsn := os.Getenv(testDSNVariable)
+		if dsn == "" && os.Getenv(ciVariable) != "" {
+			t.Fatalf("%v is not set, CI must run tests with PostgreSQL", testDSNVariable)
+		} else if dsn == "" {
+			t.Skipf("%v is not set", testDSNVariable)
+		}
+		clearPostgres(t, dsn)
+		db := &Database{}
+		db.OpenInitialize(DialectPostgres, dsn)
+		defer db.Close()
+		test(t, db)
+	})
+}
+
+// clearPostgres ... Drops tables of miner, so schema is created from scratch
+func clearPostgres(t *testing.T, dsn string) {
+	gdb, err := gorm.Open(DialectPostgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gdb.Close()
+	gdb.SingularTable(true)
+	err = gdb.DropTableIfExists(&Claims{}, &SearchResults{}, &SearchQueries{}, &Documents{}, &CompanyDomains{},
+		&CompanyClasses{}, &Companies{}, &Industries{}, &IndustryGroups{}, &Businesses{}, &Economics{}, &Taxonomies{}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addCompanies ... Adds companies of industry to database
+func addCompanies(t *testing.T, db *Database, industry string, urls ...string) Industries {
+	class := Industries{Industry: industry}
+	if err := db.Create(&class).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range urls {
+		if err := db.Create(&Companies{URL: url, IndustryID: &class.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.ResolveCompanies(); err != nil {
+		t.Fatal(err)
+	}
+	return class
+}
+
+func TestSchema(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		for _, table := range []interface{}{&Taxonomies{}, &Economics{}, &Businesses{}, &IndustryGroups{}, &Industries{},
+			&Companies{}, &CompanyClasses{}, &CompanyDomains{}, &Documents{}, &SearchQueries{}, &SearchResults{}, &Claims{}} {
+			if !db.HasTable(table) {
+				t.Errorf("table of %T is not created", table)
+			}
+		}
+		if db.Owner == "" || db.Lease != defaultLease {
+			t.Fatalf("owner %q, lease %v", db.Owner, db.Lease)
+		}
+	})
+}
+
+func TestCrawlState(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		addCompanies(t, db, "Banks", "a.com", "b.com")
+		queues := []struct {
+			get      func() []Companies
+			finished func(url string)
+		}{{db.GetCommon, db.CommonFinished}, {db.GetWayback, db.WaybackFinished},
+			{db.GetGoogle, db.GoogleFinished}, {db.GetColly, db.CollyFinished}}
+
+		for i, queue := range queues {
+			if companies := queue.get(); len(companies) != 2 || companies[0].Class != "Banks" {
+				t.Fatalf("queue %v: %+v", i, companies)
+			}
+			queue.finished("a.com")
+			if companies := queue.get(); len(companies) != 1 || companies[0].URL != "b.com" {
+				t.Fatalf("queue %v after finish: %+v", i, companies)
+			}
+		}
+		// Crawlers keep their own state
+		if companies := db.GetCompanies(); len(companies) != 2 || !companies[0].IsCollyCrawled || companies[1].IsCommonCrawled {
+			t.Fatalf("companies = %+v", companies)
+		}
+	})
+}
+
+func TestClaim(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		addCompanies(t, db, "Banks", "a.com", "b.com")
+		other := &Database{DB: db.DB, Owner: "other", Lease: time.Hour}
+
+		if !db.Claim(CrawlerColly, "a.com") || !db.Claim(CrawlerColly, "a.com") {
+			t.Fatal("company is not claimed by miner")
+		}
+		if other.Claim(CrawlerColly, "a.com") {
+			t.Fatal("company is claimed by two miners")
+		}
+		if !other.Claim(CrawlerCommon, "a.com") || !other.Claim(CrawlerColly, "b.com") {
+			t.Fatal("claims of other crawlers or companies conflict")
+		}
+		if db.Claim(CrawlerColly, "c.com") || db.Claim("unknown", "a.com") {
+			t.Fatal("unknown company or crawler is claimed")
+		}
+
+		// Failed crawl gives company to other miners, finished one is not crawled again
+		db.Release(CrawlerColly, "a.com")
+		if !other.Claim(CrawlerColly, "a.com") {
+			t.Fatal("released company is not claimed")
+		}
+		other.CollyFinished("a.com")
+		if db.Claim(CrawlerColly, "a.com") || other.Claim(CrawlerColly, "a.com") {
+			t.Fatal("finished company is claimed")
+		}
+		count := 0
+		db.Model(&Claims{}).Where("crawler = ?", CrawlerColly).Count(&count)
+		if count != 1 {
+			t.Fatalf("claims of colly = %v, want 1", count)
+		}
+
+		// Lease of stopped miner expires
+		db.Model(&Claims{}).Where("claimed_by = ?", "other").UpdateColumn("claimed_at", time.Now().Add(-2*db.Lease))
+		if !db.Claim(CrawlerColly, "b.com") {
+			t.Fatal("expired claim is not taken over")
+		}
+	})
+}
+
+func TestConcurrentClaims(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		addCompanies(t, db, "Banks", "a.com")
+		var wg sync.WaitGroup
+		claimed := make(chan string, 8)
+		for i := 0; i < cap(claimed); i++ {
+			wg.Add(1)
+			go func(miner *Database) {
+				defer wg.Done()
+				if miner.Claim(CrawlerColly, "a.com") {
+					claimed <- miner.Owner
+				}
+			}(&Database{DB: db.DB, Owner: fmt.Sprintf("miner-%d", i), Lease: time.Hour})
+		}
+		wg.Wait()
+		close(claimed)
+
+		// Only one of miners which claim company at the same time gets it
+		owners := []string{}
+		for owner := range claimed {
+			owners = append(owners, owner)
+		}
+		claims := []Claims{}
+		db.Find(&claims)
+		if len(owners) != 1 || len(claims) != 1 || claims[0].ClaimedBy != owners[0] {
+			t.Fatalf("claimed by %v, claims %+v", owners, claims)
+		}
+	})
+}
+
+func TestClaimSkipsLocked(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		if db.Dialect().GetName() != DialectPostgres {
+			t.Skip("rows are locked only on PostgreSQL")
+		}
+		addCompanies(t, db, "Banks", "a.com", "b.com")
+		other := &Database{DB: db.DB, Owner: "other", Lease: time.Hour}
+
+		// Row of company is locked by miner which is claiming it
+		lock := db.Begin()
+		if err := lock.Set("gorm:query_option", "FOR UPDATE").Where("url = ?", "a.com").First(&Companies{}).Error; err != nil {
+			lock.Rollback()
+			t.Fatal(err)
+		}
+		done := make(chan bool, 1)
+		go func() { done <- other.Claim(CrawlerColly, "a.com") }()
+		select {
+		case claimed := <-done:
+			if claimed {
+				t.Error("locked company is claimed")
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("claim waits for locked company")
+		}
+		if !other.Claim(CrawlerColly, "b.com") {
+			t.Error("company which is not locked is not claimed")
+		}
+		lock.Rollback()
+		if !other.Claim(CrawlerColly, "a.com") {
+			t.Error("unlocked company is not claimed")
+		}
+	})
+}
+
+func TestDocuments(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		class := addCompanies(t, db, "Banks", "a.com", "b.com")
+		companies := db.GetCompanies()
+		documents := []Documents{
+			{CompanyID: companies[0].ID, Crawler: "colly", Path: "colly/Banks/a.com/index.html", Hash: "h1", Size: 10},
+			{CompanyID: companies[0].ID, Crawler: "colly", Path: "colly/Banks/a.com/report.pdf", Hash: "h2", Size: 20},
+			{CompanyID: companies[1].ID, Crawler: "common", Path: "common/Banks/b.com/report.pdf", Hash: "h2", Size: 20},
+		}
+		for i := range documents {
+			if err := db.AddDocument(&documents[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.AddDocument(&Documents{CompanyID: companies[1].ID, Crawler: "colly", Path: documents[0].Path}); err == nil {
+			t.Fatal("path of document is not unique")
+		}
+
+		if !db.HasDocument("h2", "colly/Banks/a.com") || !db.HasDocument("h2", "common/Banks/b.com/") ||
+			db.HasDocument("h1", "colly/Banks/b.com") || db.HasDocument("h1", "colly/Banks/a") {
+			t.Fatal("HasDocument doesn't match hash in folder")
+		}
+		totals := db.DocumentTotals()
+		if totals[companies[0].ID] != (DocumentTotal{Files: 2, Bytes: 30}) || totals[companies[1].ID] != (DocumentTotal{Files: 1, Bytes: 20}) {
+			t.Fatalf("totals = %v", totals)
+		}
+
+		// Counters are restored from manifest
+		db.Exec("UPDATE companies SET num_html = 0, num_docs = 0")
+		db.Exec("UPDATE industries SET num_url = 0, num_html = 0, num_docs = 0")
+		if err := db.RefreshCounts(); err != nil {
+			t.Fatal(err)
+		}
+		companies = db.GetCompanies()
+		if *companies[0].NumHTML != 1 || *companies[0].NumDocs != 1 || *companies[1].NumDocs != 1 {
+			t.Fatalf("company counters: %+v", companies)
+		}
+		db.First(&class, class.ID)
+		if *class.NumURL != 2 || *class.NumHTML != 1 || *class.NumDocs != 2 {
+			t.Fatalf("class counters: %+v", class)
+		}
+	})
+}
+
+func TestDedupStats(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		addCompanies(t, db, "Banks", "a.com", "b.com")
+		for _, doc := range []Documents{
+			{CompanyID: 1, Crawler: "common", Path: "common/Banks/a.com/report.pdf", Hash: "h1", Size: 10},
+			{CompanyID: 2, Crawler: "common", Path: "common/Banks/b.com/report.pdf", Hash: "h1", Size: 10},
+			{CompanyID: 2, Crawler: "colly", Path: "colly/Banks/b.com/index.html", Hash: "h2", Size: 5},
+			{CompanyID: 2, Crawler: "colly", Path: "colly/Banks/b.com/old.html", Size: 7},
+		} {
+			if err := db.AddDocument(&doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Documents without hash are unique
+		report := db.DedupStats()
+		if report != (DedupReport{Files: 4, Bytes: 32, UniqueFiles: 3, UniqueBytes: 22}) {
+			t.Fatalf("report = %+v", report)
+		}
+	})
+}
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory ... Keeps data of crawlers in memory instead of database, so crawling, retry and balancing logic
+// can be run without SQLite file, e.g. in tests. Counters of classes are not kept. It is safe for concurrent use
+type Memory struct {
+	// ClassLevel ... Level of taxonomy, labels of which are used as classes of companies
+	ClassLevel string
+	// Taxonomy ... Classes which companies belong to
+	Taxonomy *Taxonomy
+
+	mutex     sync.Mutex
+	companies []Companies
+	documents []Documents
+	searches  map[string]memorySearch
+	claims    map[string]bool
+}
+
+// memorySearch ... Cached results of search query
+type memorySearch struct {
+	createdAt time.Time
+	results   []SearchResults
+}
+
+// Memory keeps the same data as database
+var _ Repository = (*Memory)(nil)
+
+// NewMemory ... Creates in-memory repository of companies which belong to classes of taxonomy. Companies without ID
+// are numbered in order, missing taxonomy means that companies have no classes
+func NewMemory(companies []Companies, taxonomy *Taxonomy) *Memory {
+	if taxonomy == nil {
+		taxonomy = &Taxonomy{}
+	}
+	m := &Memory{ClassLevel: LevelGroup, Taxonomy: taxonomy, searches: map[string]memorySearch{}, claims: map[string]bool{}}
+	for i, c := range companies {
+		if c.ID == 0 {
+			c.ID = i + 1
+		}
+		m.companies = append(m.companies, m.copyCompany(c))
+	}
+	return m
+}
+
+// copyCompany ... Returns company which doesn't share domains and state of sites with original one
+func (m *Memory) copyCompany(c Companies) Companies {
+	c.Domains = append([]string{}, c.Domains...)
+	c.OtherClasses = append([]CompanyClasses{}, c.OtherClasses...)
+	resolved, checked, moved := map[string]string{}, map[string]string{}, map[string]string{}
+	for site, base := range c.Resolved {
+		resolved[site] = base
+	}
+	for site, liveness := range c.Checked {
+		checked[site] = liveness
+	}
+	for site, location := range c.Moved {
+		moved[site] = location
+	}
+	c.Resolved, c.Checked, c.Moved = resolved, checked, moved
+	return c
+}
+
+// find ... Returns classified copies of companies which match filter
+func (m *Memory) find(match func(c Companies) bool) []Companies {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	companies := []Companies{}
+	for _, c := range m.companies {
+		if match(c) {
+			companies = append(companies, m.Taxonomy.Classify(m.copyCompany(c), m.ClassLevel))
+		}
+	}
+	return companies
+}
+
+// finish ... Changes state of company with URL and drops its claim for crawler
+func (m *Memory) finish(crawler string, url string, change func(c *Companies)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.claims, crawler+" "+url)
+	for i := range m.companies {
+		if m.companies[i].URL == url {
+			change(&m.companies[i])
+		}
+	}
+}
+
+// company ... Returns company with ID, nil if it is not found
+func (m *Memory) company(id int) *Companies {
+	for i := range m.companies {
+		if m.companies[i].ID == id {
+			return &m.companies[i]
+		}
+	}
+	return nil
+}
+
+// GetCompanies ... Returns all companies
+func (m *Memory) GetCompanies() []Companies {
+	return m.find(func(c Companies) bool { return true })
+}
+
+func (m *Memory) GetCommon() []Companies {
+	return m.find(func(c Companies) bool { return !c.IsCommonCrawled })
+}
+
+func (m *Memory) CommonFinished(url string) {
+	m.finish(CrawlerCommon, url, func(c *Companies) { c.IsCommonCrawled = true })
+}
+
+func (m *Memory) GetWayback() []Companies {
+	return m.find(func(c Companies) bool { return !c.IsWaybackCrawled })
+}
+
+func (m *Memory) WaybackFinished(url string) {
+	m.finish(CrawlerWayback, url, func(c *Companies) { c.IsWaybackCrawled = true })
+}
+
+func (m *Memory) GetGoogle() []Companies {
+	return m.find(func(c Companies) bool { return !c.IsGoogleCrawled })
+}
+
+func (m *Memory) GoogleFinished(url string) {
+	m.finish(CrawlerGoogle, url, func(c *Companies) { c.IsGoogleCrawled = true })
+}
+
+func (m *Memory) GetColly() []Companies {
+	return m.find(func(c Companies) bool { return !c.IsCollyCrawled })
+}
+
+func (m *Memory) CollyFinished(url string) {
+	m.finish(CrawlerColly, url, func(c *Companies) { c.IsCollyCrawled = true })
+}
+
+// Claim ... Leases company with URL for crawler. Returns false if company is already crawled by crawler or claimed
+func (m *Memory) Claim(crawler string, url string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := crawler + " " + url
+	for _, c := range m.companies {
+		if c.URL != url {
+			continue
+		}
+		crawled := map[string]bool{CrawlerCommon: c.IsCommonCrawled, CrawlerWayback: c.IsWaybackCrawled,
+			CrawlerGoogle: c.IsGoogleCrawled, CrawlerColly: c.IsCollyCrawled}
+		if done, known := crawled[crawler]; !known || done || m.claims[key] {
+			return false
+		}
+		m.claims[key] = true
+		return true
+	}
+	return false
+}
+
+// Release ... Gives up claim of company with URL for crawler
+func (m *Memory) Release(crawler string, url string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.claims, crawler+" "+url)
+}
+
+// GetIndustriesFolders ... Returns folders of classes at class level, folders of which should be created
+func (m *Memory) GetIndustriesFolders() []string {
+	return classFolders(m.GetCompanies())
+}
+
+// SetChecked ... Records liveness of site of company, scheme and host under which it responds and URL to which
+// it redirects. Site is URL of company or one of its additional domains
+func (m *Memory) SetChecked(companyID int, site string, liveness string, scheme string, host string, location string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c := m.company(companyID)
+	if c == nil {
+		return nil
+	}
+	for _, s := range c.Sites() {
+		if s != site {
+			continue
+		}
+		if site == c.URL {
+			now := time.Now()
+			c.Liveness, c.Scheme, c.Host, c.Location, c.CheckedAt = liveness, scheme, host, location, &now
+		}
+		c.Checked[site] = liveness
+		delete(c.Resolved, site)
+		if host != "" {
+			c.Resolved[site] = scheme + "://" + host
+		}
+		delete(c.Moved, site)
+		if location != "" {
+			c.Moved[site] = location
+		}
+	}
+	return nil
+}
+
+// AddDomain ... Adds additional domain of company unless domain is already known as site of some company.
+// Returns whether domain was added
+func (m *Memory) AddDomain(companyID int, domain string, kind string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, c := range m.companies {
+		for _, site := range c.Sites() {
+			if site == domain {
+				return false, nil
+			}
+		}
+	}
+	c := m.company(companyID)
+	if c == nil {
+		return false, fmt.Errorf("[AddDomain] error: company %v is not found", companyID)
+	}
+	c.Domains = append(c.Domains, domain)
+	return true, nil
+}
+
+// AddDocument ... Records collected file in documents manifest and counts it for its company
+func (m *Memory) AddDocument(doc *Documents) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = time.Now()
+	}
+	doc.ID = len(m.documents) + 1
+	m.documents = append(m.documents, *doc)
+	if c := m.company(doc.CompanyID); c != nil {
+		c.NumHTML, c.NumDocs = m.counts(c.ID)
+	}
+	return nil
+}
+
+// counts ... Returns amount of HTML pages and other documents of company
+func (m *Memory) counts(companyID int) (*uint, *uint) {
+	var html, docs uint
+	for _, doc := range m.documents {
+		if doc.CompanyID != companyID {
+			continue
+		} else if countColumn(doc.Path) == "num_html" {
+			html++
+		} else {
+			docs++
+		}
+	}
+	return &html, &docs
+}
+
+// HasDocument ... Checks whether document with the same content is already saved in the folder
+func (m *Memory) HasDocument(hash string, folder string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	prefix := strings.TrimSuffix(folder, "/") + "/"
+	for _, doc := range m.documents {
+		if doc.Hash == hash && strings.HasPrefix(doc.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDocuments ... Returns all documents of manifest in order they were collected
+func (m *Memory) GetDocuments() []Documents {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Documents{}, m.documents...)
+}
+
+// DocumentTotals ... Returns amount and size of collected documents of each company
+func (m *Memory) DocumentTotals() map[int]DocumentTotal {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	totals := map[int]DocumentTotal{}
+	for _, doc := range m.documents {
+		total := totals[doc.CompanyID]
+		total.Files++
+		total.Bytes += doc.Size
+		totals[doc.CompanyID] = total
+	}
+	return totals
+}
+
+// ClearDuplicates ... Removes near-duplicate marks from all documents
+func (m *Memory) ClearDuplicates() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.documents {
+		m.documents[i].DuplicateOf = nil
+	}
+	return nil
+}
+
+// MarkDuplicate ... Marks document as near-duplicate of another one
+func (m *Memory) MarkDuplicate(id int, of int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.documents {
+		if m.documents[i].ID == id {
+			m.documents[i].DuplicateOf = &of
+		}
+	}
+	return nil
+}
+
+// RefreshCounts ... Recounts documents of each company from documents manifest
+func (m *Memory) RefreshCounts() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.companies {
+		m.companies[i].NumHTML, m.companies[i].NumDocs = m.counts(m.companies[i].ID)
+	}
+	return nil
+}
+
+// GetSearch ... Returns cached results of search query if it was executed less than `ttl` ago
+func (m *Memory) GetSearch(query string, ttl time.Duration) ([]SearchResults, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	search, found := m.searches[query]
+	if !found || time.Since(search.createdAt) > ttl {
+		return nil, false
+	}
+	return append([]SearchResults{}, search.results...), true
+}
+
+// SaveSearch ... Caches results of executed search query, previous results of the same query are replaced
+func (m *Memory) SaveSearch(query string, results []SearchResults) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.searches[query] = memorySearch{createdAt: time.Now(), results: append([]SearchResults{}, results...)}
+	return nil
+}
+
+// GetTaxonomy ... Returns classes of all levels of taxonomy
+func (m *Memory) GetTaxonomy() *Taxonomy {
+	return m.Taxonomy
+}
+
+// GetClassLevel ... Returns level of taxonomy, labels of which are used as classes of companies
+func (m *Memory) GetClassLevel() string {
+	return m.ClassLevel
+}
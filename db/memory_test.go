@@ -0,0 +1,111 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryFinished(t *testing.T) {
+	memory := NewMemory([]Companies{{URL: "a.com"}, {URL: "b.com"}}, nil)
+	queues := []struct {
+		crawler  string
+		get      func() []Companies
+		finished func(url string)
+	}{{CrawlerCommon, memory.GetCommon, memory.CommonFinished}, {CrawlerWayback, memory.GetWayback, memory.WaybackFinished},
+		{CrawlerGoogle, memory.GetGoogle, memory.GoogleFinished}, {CrawlerColly, memory.GetColly, memory.CollyFinished}}
+
+	for _, queue := range queues {
+		if !memory.Claim(queue.crawler, "a.com") || memory.Claim(queue.crawler, "a.com") {
+			t.Fatalf("%v: company is claimed twice", queue.crawler)
+		}
+		queue.finished("a.com")
+		if companies := queue.get(); len(companies) != 1 || companies[0].URL != "b.com" {
+			t.Fatalf("%v after finish: %+v", queue.crawler, companies)
+		}
+		if memory.Claim(queue.crawler, "a.com") {
+			t.Fatalf("%v: finished company is claimed", queue.crawler)
+		}
+
+		// Released company is claimed again
+		if !memory.Claim(queue.crawler, "b.com") {
+			t.Fatalf("%v: company is not claimed", queue.crawler)
+		}
+		memory.Release(queue.crawler, "b.com")
+		if !memory.Claim(queue.crawler, "b.com") {
+			t.Fatalf("%v: released company is not claimed", queue.crawler)
+		}
+	}
+	if memory.Claim("unknown", "b.com") || memory.Claim(CrawlerColly, "c.com") {
+		t.Fatal("unknown company or crawler is claimed")
+	}
+	if c := memory.GetCompanies()[0]; !c.IsCommonCrawled || !c.IsWaybackCrawled || !c.IsGoogleCrawled || !c.IsCollyCrawled {
+		t.Fatalf("company = %+v", c)
+	}
+}
+
+func TestMemoryMatchesDatabase(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		addCompanies(t, db, "Banks", "a.com", "b.com")
+		memory := NewMemory(db.GetCompanies(), db.GetTaxonomy())
+		memory.ClassLevel = db.ClassLevel
+
+		for _, repository := range []Repository{db, memory} {
+			for _, domain := range []struct {
+				companyID int
+				domain    string
+				added     bool
+			}{{1, "a.ru", true}, {1, "a.ru", false}, {2, "a.ru", false}, {2, "a.com", false}, {2, "b.ru", true}} {
+				if added, err := repository.AddDomain(domain.companyID, domain.domain, DomainRedirect); err != nil ||
+					added != domain.added {
+					t.Fatalf("%T: AddDomain(%v, %v) = %v, %v", repository, domain.companyID, domain.domain, added, err)
+				}
+			}
+			for _, check := range []struct {
+				companyID                              int
+				site, liveness, scheme, host, location string
+			}{
+				{1, "a.com", LivenessRedirected, "https", "a.com", "https://a.ru/"},
+				{1, "a.ru", LivenessLive, "https", "www.a.ru", ""},
+				{2, "b.com", LivenessUnreachable, "", "", ""},
+				{2, "b.com", LivenessLive, "http", "b.com", ""},
+			} {
+				if err := repository.SetChecked(check.companyID, check.site, check.liveness, check.scheme, check.host,
+					check.location); err != nil {
+					t.Fatalf("%T: SetChecked(%v) = %v", repository, check.site, err)
+				}
+			}
+			documents := []Documents{
+				{CompanyID: 1, Crawler: "colly", Path: "colly/Banks/a.com/index.html", Hash: "h1", Size: 10},
+				{CompanyID: 2, Crawler: "common", Path: "common/Banks/b.com/report.pdf", Hash: "h2", Size: 20},
+			}
+			for i := range documents {
+				if err := repository.AddDocument(&documents[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		type site struct {
+			Domains                  []string
+			Checked, Resolved, Moved map[string]string
+			Liveness, Scheme, Host   string
+			Location                 string
+		}
+		state := func(companies []Companies) []site {
+			sites := []site{}
+			for _, c := range companies {
+				sites = append(sites, site{c.Domains, c.Checked, c.Resolved, c.Moved, c.Liveness, c.Scheme, c.Host, c.Location})
+			}
+			return sites
+		}
+		if stored, kept := state(db.GetCompanies()), state(memory.GetCompanies()); !reflect.DeepEqual(stored, kept) {
+			t.Fatalf("sites in database %+v, in memory %+v", stored, kept)
+		}
+		for _, query := range []struct{ hash, folder string }{{"h1", "colly/Banks/a.com"}, {"h1", "colly/Banks/a"},
+			{"h1", "colly"}, {"h2", "colly/Banks/a.com"}, {"h2", "common/Banks/b.com/"}, {"h3", "common"}} {
+			if stored, kept := db.HasDocument(query.hash, query.folder), memory.HasDocument(query.hash, query.folder); stored != kept {
+				t.Errorf("HasDocument(%v, %v) in database %v, in memory %v", query.hash, query.folder, stored, kept)
+			}
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Columns of companies which referred to classes by names in old databases. Example databases use singular `business`
+var legacyReferences = []struct {
+	column, table, name string
+	old                 []string
+}{
+	{"industry_id", "industries", "industry", []string{"industry"}},
+	{"industry_group_id", "industry_groups", "industry_groups", []string{"industry_groups"}},
+	{"business_id", "businesses", "businesses", []string{"businesses", "business"}},
+	{"economic_id", "economics", "economics", []string{"economics"}}}
+
+// tableColumns ... Returns set of columns of SQLite table, empty if table doesn't exist
+func tableColumns(tx *gorm.DB, table string) (map[string]bool, []string, error) {
+	rows, err := tx.Raw("PRAGMA table_info(" + table + ")").Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	set, columns := map[string]bool{}, []string{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, kind string
+		var value interface{}
+		if err = rows.Scan(&cid, &name, &kind, &notNull, &value, &pk); err != nil {
+			return nil, nil, err
+		}
+		set[name] = true
+		columns = append(columns, name)
+	}
+	return set, columns, rows.Err()
+}
+
+// rebuildTable ... Replaces SQLite table with table of current model, since SQLite can't drop columns and constraints.
+// Columns present in both tables are copied, `exprs` give values of other columns of new table
+func rebuildTable(tx *gorm.DB, table string, model interface{}, exprs map[string]string) error {
+	old, _, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	if err = tx.Table(table + "_new").CreateTable(model).Error; err != nil {
+		return err
+	}
+	_, columns, err := tableColumns(tx, table+"_new")
+	if err != nil {
+		return err
+	}
+	names, values := []string{}, []string{}
+	for _, column := range columns {
+		if expr, found := exprs[column]; found {
+			names, values = append(names, column), append(values, expr)
+		} else if old[column] {
+			names, values = append(names, column), append(values, column)
+		}
+	}
+	steps := []string{
+		"INSERT INTO " + table + "_new (" + strings.Join(names, ", ") + ") SELECT " + strings.Join(values, ", ") + " FROM " + table,
+		"DROP TABLE " + table,
+		"ALTER TABLE " + table + "_new RENAME TO " + table,
+	}
+	for _, step := range steps {
+		if err = tx.Exec(step).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLegacy ... Converts tables of old schema before auto migration. Class names were unique in the whole table,
+// now they are unique within taxonomy. Companies referred to classes by names in columns with broken foreign keys,
+// now they are linked to classes by IDs
+func migrateLegacy(gdb *gorm.DB) error {
+	if gdb.Dialect().GetName() != DialectSQLite {
+		return nil
+	}
+
+	gdb.Exec("PRAGMA foreign_keys = OFF")
+	defer gdb.Exec("PRAGMA foreign_keys = ON")
+
+	tx := gdb.Begin()
+	if err := migrateTables(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("[migrateLegacy] error: %v", err)
+	}
+	return tx.Commit().Error
+}
+
+func migrateTables(tx *gorm.DB) error {
+	for _, c := range classTables {
+		columns, _, err := tableColumns(tx, c.table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 || columns["taxonomy_id"] {
+			continue
+		}
+		exprs := map[string]string{}
+		if c.table == "businesses" && !columns[c.name] && columns["business"] {
+			exprs[c.name] = "business"
+		}
+		if err = rebuildTable(tx, c.table, c.model, exprs); err != nil {
+			return err
+		}
+	}
+
+	columns, _, err := tableColumns(tx, "companies")
+	if err != nil || !columns["industry"] {
+		return err
+	}
+	exprs := map[string]string{}
+	for _, ref := range legacyReferences {
+		for _, old := range ref.old {
+			if columns[old] {
+				exprs[ref.column] = "(SELECT id FROM " + ref.table + " WHERE " + ref.table + "." + ref.name + " = companies." + old + ")"
+				break
+			}
+		}
+	}
+	return rebuildTable(tx, "companies", &Companies{}, exprs)
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// legacyDatabase ... Creates SQLite database of old schema, where companies refer to classes by names.
+// Business sectors are kept in column `business`, e.g. in example databases
+func legacyDatabase(t *testing.T, business string) string {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	gdb, err := gorm.Open(DialectSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gdb.Close()
+	steps := []string{
+		`CREATE TABLE economics (id integer primary key autoincrement, economics varchar(255) UNIQUE NOT NULL,
+		num_url integer DEFAULT 0, num_html integer DEFAULT 0, num_docs integer DEFAULT 0)`,
+		`CREATE TABLE businesses (id integer primary key autoincrement, ` + business + ` varchar(255) UNIQUE NOT NULL,
+		num_url integer DEFAULT 0, num_html integer DEFAULT 0, num_docs integer DEFAULT 0)`,
+		`CREATE TABLE industry_groups (id integer primary key autoincrement, industry_groups varchar(255) UNIQUE NOT NULL,
+		num_url integer DEFAULT 0, num_html integer DEFAULT 0, num_docs integer DEFAULT 0)`,
+		`CREATE TABLE industries (id integer primary key autoincrement, industry varchar(255) UNIQUE NOT NULL,
+		num_url integer DEFAULT 0, num_html integer DEFAULT 0, num_docs integer DEFAULT 0)`,
+		`CREATE TABLE companies (id integer primary key autoincrement, url varchar(255) UNIQUE NOT NULL, name varchar(255),
+		is_common_crawled bool DEFAULT 0, is_google_crawled bool DEFAULT 0, is_colly_crawled bool DEFAULT 0,
+		num_docs integer DEFAULT 0, num_html integer DEFAULT 0,
+		industry integer REFERENCES industries(industry), industry_groups integer REFERENCES industry_groups(industry_groups),
+		` + business + ` integer REFERENCES businesses(` + business + `), economics integer REFERENCES economics(economics))`,
+		`INSERT INTO economics (economics) VALUES ('Energy'), ('Financials')`,
+		`INSERT INTO businesses (` + business + `) VALUES ('Banking Services'), ('Fossil Fuels')`,
+		`INSERT INTO industry_groups (industry_groups) VALUES ('Banking'), ('Oil & Gas')`,
+		`INSERT INTO industries (industry) VALUES ('Oil Exploration'), ('Banks')`,
+		`INSERT INTO companies (url, name, industry, industry_groups, is_colly_crawled, num_docs)
+		VALUES ('bank.com', 'Bank', 'Banks', 'Banking', 1, 3)`,
+		`INSERT INTO companies (url, industry, is_common_crawled) VALUES ('oil.com', 'Oil Exploration', 1)`,
+		`INSERT INTO companies (url, industry_groups) VALUES ('gas.com', 'Oil & Gas')`,
+		`INSERT INTO companies (url, ` + business + `) VALUES ('fuel.com', 'Fossil Fuels')`,
+		`INSERT INTO companies (url, economics) VALUES ('energy.com', 'Energy')`,
+		`INSERT INTO companies (url, industry) VALUES ('unknown.com', 'Mining')`,
+	}
+	for _, step := range steps {
+		if err = gdb.Exec(step).Error; err != nil {
+			t.Fatalf("%v: %v", step, err)
+		}
+	}
+	return path
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	for _, business := range []string{"businesses", "business"} {
+		t.Run(business, func(t *testing.T) {
+			db := &Database{}
+			db.OpenInitialize(DialectSQLite, legacyDatabase(t, business))
+			defer db.Close()
+			for _, column := range []string{"industry", "industry_groups", "business", "economics"} {
+				if db.Dialect().HasColumn("companies", column) {
+					t.Errorf("column %v of companies is not migrated", column)
+				}
+			}
+			if !db.Dialect().HasColumn("businesses", "taxonomy_id") {
+				t.Error("classes are not migrated")
+			}
+			// Classes get parents after migration, e.g. by importing taxonomy
+			steps := []string{
+				`UPDATE businesses SET economic_id = 2 WHERE id = 1`,
+				`UPDATE businesses SET economic_id = 1 WHERE id = 2`,
+				`UPDATE industry_groups SET business_id = 1 WHERE id = 1`,
+				`UPDATE industry_groups SET business_id = 2 WHERE id = 2`,
+				`UPDATE industries SET industry_group_id = 2 WHERE id = 1`,
+				`UPDATE industries SET industry_group_id = 1 WHERE id = 2`,
+			}
+			for _, step := range steps {
+				if err := db.Exec(step).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.ResolveCompanies(); err != nil {
+				t.Fatal(err)
+			}
+
+			companies := []Companies{}
+			db.Order("url").Find(&companies)
+			byURL := map[string]Companies{}
+			for _, c := range companies {
+				byURL[c.URL] = c
+			}
+			if len(byURL) != 6 {
+				t.Fatalf("companies after migration: %v, want 6", len(byURL))
+			}
+			bank := byURL["bank.com"]
+			if bank.Name != "Bank" || !bank.IsCollyCrawled || bank.NumDocs == nil || *bank.NumDocs != 3 {
+				t.Errorf("fields of company are not kept: %+v", bank)
+			}
+			if !byURL["oil.com"].IsCommonCrawled {
+				t.Errorf("crawl flag of company is not kept: %+v", byURL["oil.com"])
+			}
+
+			taxonomy := db.GetTaxonomy()
+			tests := []struct {
+				url    string
+				labels [4]string
+			}{
+				{"bank.com", [4]string{"Financials", "Banking Services", "Banking", "Banks"}},
+				{"oil.com", [4]string{"Energy", "Fossil Fuels", "Oil & Gas", "Oil Exploration"}},
+				{"gas.com", [4]string{"Energy", "Fossil Fuels", "Oil & Gas", ""}},
+				{"fuel.com", [4]string{"Energy", "Fossil Fuels", "", ""}},
+				{"energy.com", [4]string{"Energy", "", "", ""}},
+				{"unknown.com", [4]string{"", "", "", ""}},
+			}
+			for _, test := range tests {
+				c := byURL[test.url]
+				labels := taxonomy.Labels(c)
+				for i, level := range Levels {
+					if labels[level] != test.labels[i] {
+						t.Errorf("%v: label at level %v is %q, want %q", test.url, level, labels[level], test.labels[i])
+					}
+				}
+			}
+			// Unknown levels are taken from the nearest more general class, then from more specific one
+			if label := taxonomy.Label(byURL["fuel.com"], LevelIndustry); label != "Fossil Fuels" {
+				t.Errorf("industry of fuel.com is %q, want Fossil Fuels", label)
+			}
+			if label := taxonomy.Label(byURL["energy.com"], LevelGroup); label != "Energy" {
+				t.Errorf("group of energy.com is %q, want Energy", label)
+			}
+			if label := taxonomy.Label(byURL["unknown.com"], LevelGroup); label != "" {
+				t.Errorf("company of unknown class is labeled %q", label)
+			}
+
+			// Foreign keys are enforced again after migration
+			missing := 100
+			if err := db.Create(&Companies{URL: "new.com", IndustryID: &missing}).Error; err == nil {
+				t.Error("company of missing class is created")
+			}
+		})
+	}
+}
+
+// TestMigrateExample ... Example database keeps classes of companies after migration
+func TestMigrateExample(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "industries.db")
+	source, err := os.Open(filepath.Join("..", "database_examples", "industries.db"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer source.Close()
+	target, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(target, source); err != nil {
+		t.Fatal(err)
+	}
+	target.Close()
+
+	gdb, err := gorm.Open(DialectSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := gdb.Raw(`SELECT c.url, COALESCE(i.industry, ''), COALESCE(g.industry_groups, '')
+		FROM companies c LEFT JOIN industries i ON i.industry = c.industry
+		LEFT JOIN industry_groups g ON g.industry_groups = c.industry_groups`).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	industries, groups := map[string]string{}, map[string]string{}
+	for rows.Next() {
+		var url, industry, group string
+		if err = rows.Scan(&url, &industry, &group); err != nil {
+			t.Fatal(err)
+		}
+		industries[url], groups[url] = industry, group
+	}
+	rows.Close()
+	gdb.Close()
+
+	db := &Database{}
+	db.OpenInitialize(DialectSQLite, path)
+	defer db.Close()
+	companies := []Companies{}
+	db.Find(&companies)
+	if len(companies) == 0 {
+		t.Fatal("companies are lost")
+	}
+	taxonomy := db.GetTaxonomy()
+	linked := 0
+	for _, c := range companies {
+		industry, found := industries[c.URL]
+		if !found {
+			// Site was normalized, so it can't be matched
+			continue
+		}
+		labels := taxonomy.Labels(c)
+		if labels[LevelIndustry] != industry {
+			t.Errorf("%v: industry is %q, want %q", c.URL, labels[LevelIndustry], industry)
+		}
+		if groups[c.URL] != "" && labels[LevelGroup] != groups[c.URL] {
+			t.Errorf("%v: group is %q, want %q", c.URL, labels[LevelGroup], groups[c.URL])
+		}
+		if industry != "" {
+			linked++
+		}
+	}
+	if linked == 0 {
+		t.Error("no company is linked to industry")
+	}
+}
@@ -0,0 +1,72 @@
+package db
+
+import "time"
+
+// Repository ... Data which crawlers work with: queues of companies, their crawl state and sites, manifest
+// of collected documents, cached searches and taxonomy. `Database` keeps them in SQLite or PostgreSQL,
+// `Memory` keeps them in memory, so crawling logic can be run without database
+type Repository interface {
+	// GetCompanies ... Returns all companies with their classes and domains
+	GetCompanies() []Companies
+	// GetCommon ... Returns companies which are not crawled from Common Crawl yet
+	GetCommon() []Companies
+	// CommonFinished ... Marks company with URL as crawled from Common Crawl
+	CommonFinished(url string)
+	// GetWayback ... Returns companies which are not crawled from Wayback Machine yet
+	GetWayback() []Companies
+	// WaybackFinished ... Marks company with URL as crawled from Wayback Machine
+	WaybackFinished(url string)
+	// GetGoogle ... Returns companies which are not searched by Google yet
+	GetGoogle() []Companies
+	// GoogleFinished ... Marks company with URL as searched by Google
+	GoogleFinished(url string)
+	// GetColly ... Returns companies which are not crawled by Colly yet
+	GetColly() []Companies
+	// CollyFinished ... Marks company with URL as crawled by Colly
+	CollyFinished(url string)
+	// Claim ... Leases company with URL to this miner for crawler, returns false if it is crawled or claimed by another
+	// miner. Claim is dropped when crawler finishes company
+	Claim(crawler string, url string) bool
+	// Release ... Gives up claim of company, so other miners can crawl it
+	Release(crawler string, url string)
+	// GetIndustriesFolders ... Returns classes of companies, documents of which are saved in their folders
+	GetIndustriesFolders() []string
+
+	// SetChecked ... Records liveness of site of company, scheme and host under which it responds and its redirect
+	SetChecked(companyID int, site string, liveness string, scheme string, host string, location string) error
+	// AddDomain ... Adds additional domain of company unless it is known, returns whether it was added
+	AddDomain(companyID int, domain string, kind string) (bool, error)
+
+	// AddDocument ... Records collected file in documents manifest
+	AddDocument(doc *Documents) error
+	// HasDocument ... Checks whether document with hash is already saved into folder
+	HasDocument(hash string, folder string) bool
+	// GetDocuments ... Returns all documents of manifest in order they were collected
+	GetDocuments() []Documents
+	// DocumentTotals ... Returns amount and size of collected documents of each company
+	DocumentTotals() map[int]DocumentTotal
+	// ClearDuplicates ... Removes near-duplicate marks from all documents
+	ClearDuplicates() error
+	// MarkDuplicate ... Marks document as near-duplicate of another one
+	MarkDuplicate(id int, of int) error
+	// RefreshCounts ... Recounts documents of each company and class
+	RefreshCounts() error
+
+	// GetSearch ... Returns cached results of search query if it was executed less than `ttl` ago
+	GetSearch(query string, ttl time.Duration) ([]SearchResults, bool)
+	// SaveSearch ... Caches results of executed search query
+	SaveSearch(query string, results []SearchResults) error
+
+	// GetTaxonomy ... Returns classes of all levels of used taxonomy
+	GetTaxonomy() *Taxonomy
+	// GetClassLevel ... Returns level of taxonomy, labels of which are used as classes of companies
+	GetClassLevel() string
+}
+
+// Database keeps data of crawlers in SQLite or PostgreSQL
+var _ Repository = (*Database)(nil)
+
+// GetClassLevel ... Returns level of taxonomy, labels of which are used as classes of companies
+func (db *Database) GetClassLevel() string {
+	return db.ClassLevel
+}
@@ -0,0 +1,41 @@
+package db
+
+import "time"
+
+// GetSearch ... Returns cached results of search query if it was executed less than `ttl` ago
+func (db *Database) GetSearch(query string, ttl time.Duration) ([]SearchResults, bool) {
+	search := SearchQueries{}
+	db.Where("query = ?", query).First(&search)
+	if search.ID == 0 || time.Since(search.CreatedAt) > ttl {
+		return nil, false
+	}
+
+	results := []SearchResults{}
+	db.Where("query_id = ?", search.ID).Order("rank").Find(&results)
+	return results, true
+}
+
+// SaveSearch ... Caches results of executed search query, previous results of the same query are replaced
+func (db *Database) SaveSearch(query string, results []SearchResults) error {
+	tx := db.Begin()
+	old := SearchQueries{}
+	tx.Where("query = ?", query).First(&old)
+	if old.ID != 0 {
+		tx.Where("query_id = ?", old.ID).Delete(&SearchResults{})
+		tx.Delete(&old)
+	}
+
+	search := SearchQueries{Query: query, CreatedAt: time.Now()}
+	if err := tx.Create(&search).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, r := range results {
+		r.QueryID = search.ID
+		if err := tx.Create(&r).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
@@ -1,58 +1,217 @@
 package db
 
-//Industries ... Industried by `Thomson Reuters Business Classification` and number of files belonging to them
+import "time"
+
+// Taxonomies ... Named taxonomies of classes, e.g. TRBC or user-defined topics. Several taxonomies can be kept
+// in one database, names of classes are unique within their taxonomy
+type Taxonomies struct {
+	ID          int    `gorm:"primary_key;AUTO_INCREMENT"`
+	Name        string `gorm:"unique;not null"`
+	Description string
+}
+
+//Industries ... Industries of taxonomy like `Thomson Reuters Business Classification`, the most specific level of taxonomy,
+// and number of files belonging to them
 type Industries struct {
 	//gorm.Model
-	ID       int    `gorm:"primary_key;AUTO_INCREMENT"`
-	Industry string `gorm:"unique;not null"`
-	NumURL   *uint  `gorm:"default:0"`
-	NumHTML  *uint  `gorm:"default:0"`
-	NumDocs  *uint  `gorm:"default:0"`
+	ID              int    `gorm:"primary_key;AUTO_INCREMENT"`
+	Industry        string `gorm:"not null;unique_index:uix_industries_taxonomy"`
+	Code            string
+	TaxonomyID      *int  `sql:"type:integer REFERENCES taxonomies(id)" gorm:"unique_index:uix_industries_taxonomy"`
+	IndustryGroupID *int  `sql:"type:integer REFERENCES industry_groups(id)"`
+	NumURL          *uint `gorm:"default:0"`
+	NumHTML         *uint `gorm:"default:0"`
+	NumDocs         *uint `gorm:"default:0"`
 }
 
-//Industries ... Industried by `Thomson Reuters Business Classification` and number of files belonging to them
+//IndustryGroups ... Industry groups of taxonomy like `Thomson Reuters Business Classification` and number of files belonging to them
 type IndustryGroups struct {
 	//gorm.Model
 	ID             int    `gorm:"primary_key;AUTO_INCREMENT"`
-	IndustryGroups string `gorm:"unique;not null"`
-	NumURL         *uint  `gorm:"default:0"`
-	NumHTML        *uint  `gorm:"default:0"`
-	NumDocs        *uint  `gorm:"default:0"`
+	IndustryGroups string `gorm:"not null;unique_index:uix_industry_groups_taxonomy"`
+	Code           string
+	TaxonomyID     *int  `sql:"type:integer REFERENCES taxonomies(id)" gorm:"unique_index:uix_industry_groups_taxonomy"`
+	BusinessID     *int  `sql:"type:integer REFERENCES businesses(id)"`
+	NumURL         *uint `gorm:"default:0"`
+	NumHTML        *uint `gorm:"default:0"`
+	NumDocs        *uint `gorm:"default:0"`
 }
 
-//Industries ... Industried by `Thomson Reuters Businesses Classification` and number of files belonging to them
+//Businesses ... Business sectors of taxonomy like `Thomson Reuters Business Classification` and number of files belonging to them
 type Businesses struct {
 	//gorm.Model
 	ID         int    `gorm:"primary_key;AUTO_INCREMENT"`
-	Businesses string `gorm:"unique;not null"`
-	NumURL     *uint  `gorm:"default:0"`
-	NumHTML    *uint  `gorm:"default:0"`
-	NumDocs    *uint  `gorm:"default:0"`
+	Businesses string `gorm:"not null;unique_index:uix_businesses_taxonomy"`
+	Code       string
+	TaxonomyID *int  `sql:"type:integer REFERENCES taxonomies(id)" gorm:"unique_index:uix_businesses_taxonomy"`
+	EconomicID *int  `sql:"type:integer REFERENCES economics(id)"`
+	NumURL     *uint `gorm:"default:0"`
+	NumHTML    *uint `gorm:"default:0"`
+	NumDocs    *uint `gorm:"default:0"`
 }
 
-//Industries ... Industried by `Thomson Reuters Business Classification` and number of files belonging to them
+//Economics ... Economic sectors of taxonomy like `Thomson Reuters Business Classification`, the most general level of taxonomy,
+// and number of files belonging to them
 type Economics struct {
 	//gorm.Model
-	ID        int    `gorm:"primary_key;AUTO_INCREMENT"`
-	Economics string `gorm:"unique;not null"`
-	NumURL    *uint  `gorm:"default:0"`
-	NumHTML   *uint  `gorm:"default:0"`
-	NumDocs   *uint  `gorm:"default:0"`
+	ID         int    `gorm:"primary_key;AUTO_INCREMENT"`
+	Economics  string `gorm:"not null;unique_index:uix_economics_taxonomy"`
+	Code       string
+	TaxonomyID *int  `sql:"type:integer REFERENCES taxonomies(id)" gorm:"unique_index:uix_economics_taxonomy"`
+	NumURL     *uint `gorm:"default:0"`
+	NumHTML    *uint `gorm:"default:0"`
+	NumDocs    *uint `gorm:"default:0"`
 }
 
-// Companies ... Companies with URL and other info that belong to some industry
+// Companies ... Companies with URL and other info that belong to some class of taxonomy. It is enough to link
+// the most specific known class, more general ones are taken from its parents. URL is canonical domain of site,
+// scheme and host under which site responds and its liveness are checked before crawling
 type Companies struct {
 	//gorm.Model
-	ID              int    `gorm:"primary_key;AUTO_INCREMENT"`
-	URL             string `gorm:"unique;not null"`
-	Name            string
-	IsCommonCrawled bool   `gorm:"default:0"`
-	IsGoogleCrawled bool   `gorm:"default:0"`
-	IsCollyCrawled  bool   `gorm:"default:0"`
-	NumDocs         *uint  `gorm:"default:0"`
-	NumHTML         *uint  `gorm:"default:0"`
-	Industry        string `sql:"type:integer REFERENCES Industries(industry)"`
-	IndustryGroups  string `sql:"type:integer REFERENCES IndustryGroups(industry_groups)"`
-	Businesses      string `sql:"type:integer REFERENCES Businesses(businesses)"`
-	Economics       string `sql:"type:integer REFERENCES Economics(economics)"`
+	ID               int    `gorm:"primary_key;AUTO_INCREMENT"`
+	URL              string `gorm:"unique;not null"`
+	Name             string
+	Scheme           string
+	Host             string
+	Location         string
+	Liveness         string
+	CheckedAt        *time.Time
+	IsCommonCrawled  bool  `gorm:"default:false"`
+	IsGoogleCrawled  bool  `gorm:"default:false"`
+	IsCollyCrawled   bool  `gorm:"default:false"`
+	IsWaybackCrawled bool  `gorm:"default:false"`
+	NumDocs          *uint `gorm:"default:0"`
+	NumHTML          *uint `gorm:"default:0"`
+	IndustryID       *int  `sql:"type:integer REFERENCES industries(id)"`
+	IndustryGroupID  *int  `sql:"type:integer REFERENCES industry_groups(id)"`
+	BusinessID       *int  `sql:"type:integer REFERENCES businesses(id)"`
+	EconomicID       *int  `sql:"type:integer REFERENCES economics(id)"`
+	// Class ... Label of primary company class at class level of database, it is not stored
+	Class string `gorm:"-"`
+	// Labels ... Labels of all company classes at class level of database, primary one goes first
+	Labels []ClassLabel `gorm:"-"`
+	// OtherClasses ... Additional classes of company
+	OtherClasses []CompanyClasses `gorm:"-"`
+	// Domains ... Additional domains of company, it is not stored here
+	Domains []string `gorm:"-"`
+	// Resolved ... Base URLs under which sites of company respond, e.g. `https://www.example.com`
+	Resolved map[string]string `gorm:"-"`
+	// Checked ... Liveness of checked sites of company
+	Checked map[string]string `gorm:"-"`
+	// Moved ... URLs to which sites of company redirect, e.g. after rebranding
+	Moved map[string]string `gorm:"-"`
+}
+
+// Sites ... Returns URL of company followed by its additional domains
+func (c Companies) Sites() []string {
+	return append([]string{c.URL}, c.Domains...)
+}
+
+// Dead ... Checks whether all sites of company are checked and have one of `dead` liveness statuses
+func (c Companies) Dead(dead map[string]bool) bool {
+	for _, site := range c.Sites() {
+		if liveness, found := c.Checked[site]; !found || !dead[liveness] {
+			return false
+		}
+	}
+	return true
+}
+
+// StartURL ... Returns base URL of site of company, HTTPS is expected for site which is not resolved yet
+func (c Companies) StartURL(site string) string {
+	return c.BaseURLs(site)[0]
+}
+
+// BaseURLs ... Returns base URLs under which site of company may respond. Site which is not resolved yet has all
+// variants of scheme and `www.` in order they are tried, resolved site has only the one it responds under
+func (c Companies) BaseURLs(site string) []string {
+	if base, found := c.Resolved[site]; found {
+		return []string{base}
+	}
+	return SiteVariants(site)
+}
+
+// SiteVariants ... Returns base URLs of domain with HTTPS and HTTP, with and without `www.`, HTTPS goes first
+func SiteVariants(domain string) []string {
+	return []string{"https://" + domain, "https://www." + domain, "http://" + domain, "http://www." + domain}
+}
+
+// CompanyDomains ... Additional domains of companies, e.g. sites for investor relations, regional sites or site
+// of group holding. They are crawled together with main URL of company and saved into the same folder.
+// Like URL of company, domain is kept in canonical form and checked before crawling
+type CompanyDomains struct {
+	ID        int    `gorm:"primary_key;AUTO_INCREMENT"`
+	CompanyID int    `sql:"type:integer REFERENCES companies(id) ON DELETE CASCADE" gorm:"not null;index"`
+	Domain    string `gorm:"unique;not null"`
+	Kind      string
+	Scheme    string
+	Host      string
+	Location  string
+	Liveness  string
+	CheckedAt *time.Time
+}
+
+// CompanyClasses ... Additional classes of companies which belong to several classes, e.g. conglomerates.
+// Class is linked at any level like in companies. Class of company itself is primary, unless other class
+// is marked as primary. Weight shows how much company belongs to the class
+type CompanyClasses struct {
+	ID              int     `gorm:"primary_key;AUTO_INCREMENT"`
+	CompanyID       int     `sql:"type:integer REFERENCES companies(id) ON DELETE CASCADE" gorm:"not null;index"`
+	IndustryID      *int    `sql:"type:integer REFERENCES industries(id)"`
+	IndustryGroupID *int    `sql:"type:integer REFERENCES industry_groups(id)"`
+	BusinessID      *int    `sql:"type:integer REFERENCES businesses(id)"`
+	EconomicID      *int    `sql:"type:integer REFERENCES economics(id)"`
+	IsPrimary       bool    `gorm:"default:false"`
+	Weight          float64 `gorm:"default:1"`
+}
+
+// ClassLabel ... Label of one of company classes
+type ClassLabel struct {
+	Class   string  `json:"class"`
+	Primary bool    `json:"primary"`
+	Weight  float64 `json:"weight"`
+}
+
+// Documents ... Files collected by crawlers and the sources they came from
+type Documents struct {
+	ID          int    `gorm:"primary_key;AUTO_INCREMENT"`
+	CompanyID   int    `sql:"type:integer REFERENCES companies(id)"`
+	Crawler     string `gorm:"not null"`
+	Path        string `gorm:"unique;not null"`
+	URL         string
+	Hash        string `gorm:"index"`
+	Size        int64
+	DuplicateOf *int `sql:"type:integer REFERENCES documents(id)"`
+	Snapshot    string
+	Period      string
+	Truncated   bool
+	CapturedAt  time.Time
+	CreatedAt   time.Time
+}
+
+// SearchQueries ... Executed search engine queries, results of which are cached
+type SearchQueries struct {
+	ID        int    `gorm:"primary_key;AUTO_INCREMENT"`
+	Query     string `gorm:"unique;not null"`
+	CreatedAt time.Time
+}
+
+// SearchResults ... Parsed results of cached search query in order of their rank
+type SearchResults struct {
+	ID          int `gorm:"primary_key;AUTO_INCREMENT"`
+	QueryID     int `sql:"type:integer REFERENCES search_queries(id) ON DELETE CASCADE"`
+	Rank        int
+	URL         string
+	Title       string
+	Description string
+}
+
+// Claims ... Companies which are being crawled. Miners sharing database lease company for crawler, so it is not
+// crawled twice. Lease of miner which crashed expires
+type Claims struct {
+	ID        int       `gorm:"primary_key;AUTO_INCREMENT"`
+	CompanyID int       `sql:"type:integer REFERENCES companies(id) ON DELETE CASCADE" gorm:"not null;unique_index:uix_claims_company_crawler"`
+	Crawler   string    `gorm:"not null;unique_index:uix_claims_company_crawler"`
+	ClaimedBy string    `gorm:"not null"`
+	ClaimedAt time.Time `gorm:"not null"`
 }
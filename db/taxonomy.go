@@ -0,0 +1,370 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Levels of taxonomy from the most general to the most specific
+const (
+	LevelEconomic = "economic_sector"
+	LevelBusiness = "business_sector"
+	LevelGroup    = "industry_group"
+	LevelIndustry = "industry"
+)
+
+// Levels ... All levels of taxonomy from the most general to the most specific
+var Levels = []string{LevelEconomic, LevelBusiness, LevelGroup, LevelIndustry}
+
+// Tables of taxonomy levels from the most general one, their models, columns of class names and references to parents
+var classTables = []struct {
+	level, table, name, parent string
+	model                      interface{}
+}{
+	{LevelEconomic, "economics", "economics", "", &Economics{}},
+	{LevelBusiness, "businesses", "businesses", "economic_id", &Businesses{}},
+	{LevelGroup, "industry_groups", "industry_groups", "business_id", &IndustryGroups{}},
+	{LevelIndustry, "industries", "industry", "industry_group_id", &Industries{}}}
+
+// Taxonomy ... Classes of all levels loaded from database, resolves labels of companies at any level
+type Taxonomy struct {
+	Economics  map[int]Economics
+	Businesses map[int]Businesses
+	Groups     map[int]IndustryGroups
+	Industries map[int]Industries
+}
+
+// IsLevel ... Checks whether name is one of taxonomy levels
+func IsLevel(level string) bool {
+	for _, l := range Levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// UseTaxonomy ... Makes database use classes of only one taxonomy, companies of other taxonomies are not returned.
+// Empty name means classes of all taxonomies
+func (db *Database) UseTaxonomy(name string) error {
+	db.taxonomyID = 0
+	if name == "" {
+		return nil
+	}
+	taxonomy := Taxonomies{}
+	if db.Where("name = ?", name).First(&taxonomy).RecordNotFound() {
+		return fmt.Errorf("[UseTaxonomy] taxonomy %v is not found", name)
+	}
+	db.taxonomyID = taxonomy.ID
+	return nil
+}
+
+// classes ... Returns query of classes of used taxonomy
+func (db *Database) classes() *gorm.DB {
+	if db.taxonomyID == 0 {
+		return db.DB
+	}
+	return db.Where("taxonomy_id = ?", db.taxonomyID)
+}
+
+// GetTaxonomy ... Loads classes of all levels of used taxonomy
+func (db *Database) GetTaxonomy() *Taxonomy {
+	t := &Taxonomy{Economics: map[int]Economics{}, Businesses: map[int]Businesses{},
+		Groups: map[int]IndustryGroups{}, Industries: map[int]Industries{}}
+
+	economics := []Economics{}
+	db.classes().Find(&economics)
+	for _, e := range economics {
+		t.Economics[e.ID] = e
+	}
+	businesses := []Businesses{}
+	db.classes().Find(&businesses)
+	for _, b := range businesses {
+		t.Businesses[b.ID] = b
+	}
+	groups := []IndustryGroups{}
+	db.classes().Find(&groups)
+	for _, g := range groups {
+		t.Groups[g.ID] = g
+	}
+	industries := []Industries{}
+	db.classes().Find(&industries)
+	for _, i := range industries {
+		t.Industries[i.ID] = i
+	}
+	return t
+}
+
+func idOf(id *int) int {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// ids ... Returns IDs of company classes at all levels from the most general one. Class which is not linked
+// to company is taken from parent of more specific class, 0 means unknown class
+func (t *Taxonomy) ids(c Companies) [4]int {
+	industry := idOf(c.IndustryID)
+	group := idOf(c.IndustryGroupID)
+	if group == 0 {
+		group = idOf(t.Industries[industry].IndustryGroupID)
+	}
+	business := idOf(c.BusinessID)
+	if business == 0 {
+		business = idOf(t.Groups[group].BusinessID)
+	}
+	economic := idOf(c.EconomicID)
+	if economic == 0 {
+		economic = idOf(t.Businesses[business].EconomicID)
+	}
+	return [4]int{economic, business, group, industry}
+}
+
+// Labels ... Returns labels of company classes at all levels, unknown levels are empty
+func (t *Taxonomy) Labels(c Companies) map[string]string {
+	ids := t.ids(c)
+	return map[string]string{
+		LevelEconomic: t.Economics[ids[0]].Economics,
+		LevelBusiness: t.Businesses[ids[1]].Businesses,
+		LevelGroup:    t.Groups[ids[2]].IndustryGroups,
+		LevelIndustry: t.Industries[ids[3]].Industry,
+	}
+}
+
+// Label ... Returns label of company class at `level`. If class of this level is unknown, the nearest more
+// general class is used, then the nearest more specific one. Empty label means that company is not classified
+func (t *Taxonomy) Label(c Companies, level string) string {
+	labels := t.Labels(c)
+	index := 0
+	for i, l := range Levels {
+		if l == level {
+			index = i
+		}
+	}
+	for i := index; i >= 0; i-- {
+		if labels[Levels[i]] != "" {
+			return labels[Levels[i]]
+		}
+	}
+	for i := index + 1; i < len(Levels); i++ {
+		if labels[Levels[i]] != "" {
+			return labels[Levels[i]]
+		}
+	}
+	return ""
+}
+
+// CompanyLabels ... Returns labels of all classes of company at `level`, primary one goes first and others are
+// sorted by weight. Classes of unknown labels are skipped
+func (t *Taxonomy) CompanyLabels(c Companies, level string) []ClassLabel {
+	primary := false
+	for _, other := range c.OtherClasses {
+		primary = primary || other.IsPrimary
+	}
+	labels := []ClassLabel{}
+	add := func(label ClassLabel) {
+		if label.Class == "" {
+			return
+		}
+		for i := range labels {
+			if labels[i].Class == label.Class {
+				labels[i].Primary = labels[i].Primary || label.Primary
+				labels[i].Weight = math.Max(labels[i].Weight, label.Weight)
+				return
+			}
+		}
+		labels = append(labels, label)
+	}
+
+	add(ClassLabel{Class: t.Label(c, level), Primary: !primary, Weight: 1})
+	for _, other := range c.OtherClasses {
+		class := Companies{IndustryID: other.IndustryID, IndustryGroupID: other.IndustryGroupID,
+			BusinessID: other.BusinessID, EconomicID: other.EconomicID}
+		add(ClassLabel{Class: t.Label(class, level), Primary: other.IsPrimary, Weight: other.Weight})
+	}
+	sort.SliceStable(labels, func(i, j int) bool {
+		if labels[i].Primary != labels[j].Primary {
+			return labels[i].Primary
+		}
+		return labels[i].Weight > labels[j].Weight
+	})
+	return labels
+}
+
+// Classify ... Sets labels of company classes at `level` and class of company, which is label of primary class
+func (t *Taxonomy) Classify(c Companies, level string) Companies {
+	c.Labels = t.CompanyLabels(c, level)
+	c.Class = ""
+	if len(c.Labels) > 0 {
+		c.Class = c.Labels[0].Class
+	}
+	return c
+}
+
+// classify ... Sets class labels of companies at class level of database. If only one taxonomy is used,
+// companies which have no class in it are dropped
+func (db *Database) classify(companies []Companies) []Companies {
+	t := db.GetTaxonomy()
+	others := []CompanyClasses{}
+	db.Find(&others)
+	classes := map[int][]CompanyClasses{}
+	for _, other := range others {
+		classes[other.CompanyID] = append(classes[other.CompanyID], other)
+	}
+
+	classified := []Companies{}
+	for _, c := range companies {
+		c.OtherClasses = classes[c.ID]
+		c = t.Classify(c, db.ClassLevel)
+		if c.Class != "" || db.taxonomyID == 0 {
+			classified = append(classified, c)
+		}
+	}
+	return classified
+}
+
+// ResolveCompanies ... Links companies to classes of all levels which are known from parents of their classes,
+// so companies can be counted at each level
+func (db *Database) ResolveCompanies() error {
+	steps := []string{
+		`UPDATE companies SET industry_group_id = (SELECT industry_group_id FROM industries WHERE id = companies.industry_id)
+		WHERE industry_group_id IS NULL AND industry_id IS NOT NULL`,
+		`UPDATE companies SET business_id = (SELECT business_id FROM industry_groups WHERE id = companies.industry_group_id)
+		WHERE business_id IS NULL AND industry_group_id IS NOT NULL`,
+		`UPDATE companies SET economic_id = (SELECT economic_id FROM businesses WHERE id = companies.business_id)
+		WHERE economic_id IS NULL AND business_id IS NOT NULL`,
+	}
+	for _, step := range steps {
+		if err := db.Exec(step).Error; err != nil {
+			return fmt.Errorf("[ResolveCompanies] error: %v", err)
+		}
+	}
+	return nil
+}
+
+// ClassDefinition ... Class of taxonomy definition. Parent is code or name of class at the next more general level
+type ClassDefinition struct {
+	Level  string `json:"level" yaml:"level"`
+	Code   string `json:"code" yaml:"code"`
+	Name   string `json:"name" yaml:"name"`
+	Parent string `json:"parent" yaml:"parent"`
+}
+
+// TaxonomyDefinition ... Taxonomy with its classes, e.g. loaded from file
+type TaxonomyDefinition struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description" yaml:"description"`
+	Classes     []ClassDefinition `json:"classes" yaml:"classes"`
+}
+
+// ImportTaxonomy ... Creates taxonomy with its classes or updates existing one. Classes are matched by code,
+// then by name, so import can be repeated after definition is changed. Classes which don't belong to any
+// taxonomy yet are taken into the imported one by name
+func (db *Database) ImportTaxonomy(def TaxonomyDefinition) error {
+	if def.Name == "" {
+		return fmt.Errorf("[ImportTaxonomy] taxonomy has no name")
+	}
+	// Codes and names identify classes of a level, so duplicates would silently overwrite each other
+	seen := map[string]bool{}
+	for _, class := range def.Classes {
+		if !IsLevel(class.Level) {
+			return fmt.Errorf("[ImportTaxonomy] unknown level %q of class %v", class.Level, class.Name)
+		}
+		if class.Name == "" {
+			return fmt.Errorf("[ImportTaxonomy] class %q of level %v has no name", class.Code, class.Level)
+		}
+		if seen[class.Level+"/name/"+class.Name] {
+			return fmt.Errorf("[ImportTaxonomy] duplicate class %v of level %v", class.Name, class.Level)
+		}
+		if class.Code != "" && seen[class.Level+"/code/"+class.Code] {
+			return fmt.Errorf("[ImportTaxonomy] duplicate code %v of class %v", class.Code, class.Name)
+		}
+		seen[class.Level+"/name/"+class.Name], seen[class.Level+"/code/"+class.Code] = true, true
+	}
+
+	tx := db.Begin()
+	taxonomy := Taxonomies{}
+	err := tx.Where(Taxonomies{Name: def.Name}).Assign(Taxonomies{Description: def.Description}).FirstOrCreate(&taxonomy).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("[ImportTaxonomy] error: %v", err)
+	}
+
+	// IDs of imported classes of the previous level by their codes and names
+	parents := map[string]int{}
+	for i, level := range classTables {
+		imported := map[string]int{}
+		for _, class := range def.Classes {
+			if class.Level != level.level {
+				continue
+			}
+			var parent *int
+			if class.Parent != "" {
+				id, found := parents[class.Parent]
+				if i == 0 || !found {
+					tx.Rollback()
+					return fmt.Errorf("[ImportTaxonomy] parent %v of class %v is not found", class.Parent, class.Name)
+				}
+				parent = &id
+			}
+			id, err := saveClass(tx, i, taxonomy.ID, class, parent)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("[ImportTaxonomy] class %v: %v", class.Name, err)
+			}
+			imported[class.Name] = id
+			if class.Code != "" {
+				imported[class.Code] = id
+			}
+		}
+		parents = imported
+	}
+	return tx.Commit().Error
+}
+
+// saveClass ... Updates class of taxonomy at level with index `i` or creates it. Returns ID of the class
+func saveClass(tx *gorm.DB, i int, taxonomyID int, class ClassDefinition, parent *int) (int, error) {
+	level := classTables[i]
+	find := func() (int, error) {
+		id := 0
+		err := sql.ErrNoRows
+		if class.Code != "" {
+			err = tx.Table(level.table).Select("id").Where("taxonomy_id = ? AND code = ?", taxonomyID, class.Code).Row().Scan(&id)
+		}
+		if err == sql.ErrNoRows {
+			err = tx.Table(level.table).Select("id").Where("taxonomy_id = ? AND "+level.name+" = ?", taxonomyID, class.Name).Row().Scan(&id)
+		}
+		// Classes made before taxonomies were introduced are adopted, so their companies keep links
+		if err == sql.ErrNoRows {
+			err = tx.Table(level.table).Select("id").Where("taxonomy_id IS NULL AND "+level.name+" = ?", class.Name).Row().Scan(&id)
+		}
+		return id, err
+	}
+
+	values := map[string]interface{}{level.name: class.Name, "code": class.Code, "taxonomy_id": taxonomyID}
+	if level.parent != "" {
+		values[level.parent] = parent
+	}
+	id, err := find()
+	if err == sql.ErrNoRows {
+		columns, marks, args := []string{}, []string{}, []interface{}{}
+		for column, value := range values {
+			columns, marks, args = append(columns, column), append(marks, "?"), append(args, value)
+		}
+		err = tx.Exec("INSERT INTO "+level.table+" ("+strings.Join(columns, ", ")+") VALUES ("+strings.Join(marks, ", ")+")", args...).Error
+		if err != nil {
+			return 0, err
+		}
+		return find()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Table(level.table).Where("id = ?", id).Updates(values).Error
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTaxonomy ... Returns taxonomy where groups Banks (1) and Insurance (2) belong to sector Financials (1),
+// group Oil (3) to sector Energy (2), and industry Reinsurance (1) to group Insurance
+func testTaxonomy() *Taxonomy {
+	financials, energy, insurance := 1, 2, 2
+	return &Taxonomy{
+		Businesses: map[int]Businesses{
+			financials: {ID: financials, Businesses: "Financials"},
+			energy:     {ID: energy, Businesses: "Energy"}},
+		Groups: map[int]IndustryGroups{
+			1: {ID: 1, IndustryGroups: "Banks", BusinessID: &financials},
+			2: {ID: 2, IndustryGroups: "Insurance", BusinessID: &financials},
+			3: {ID: 3, IndustryGroups: "Oil", BusinessID: &energy}},
+		Industries: map[int]Industries{
+			1: {ID: 1, Industry: "Reinsurance", IndustryGroupID: &insurance}},
+	}
+}
+
+func TestCompanyLabels(t *testing.T) {
+	banks, insurance, oil, reinsurance, missing := 1, 2, 3, 1, 10
+	other := func(group *int, industry *int, primary bool, weight float64) CompanyClasses {
+		return CompanyClasses{IndustryGroupID: group, IndustryID: industry, IsPrimary: primary, Weight: weight}
+	}
+	tests := []struct {
+		name   string
+		others []CompanyClasses
+		level  string
+		want   []ClassLabel
+	}{
+		{"single class", nil, LevelGroup, []ClassLabel{{"Banks", true, 1}}},
+		{"sorted by weight", []CompanyClasses{other(&oil, nil, false, 0.5), other(&insurance, nil, false, 2)}, LevelGroup,
+			[]ClassLabel{{"Banks", true, 1}, {"Insurance", false, 2}, {"Oil", false, 0.5}}},
+		{"other primary", []CompanyClasses{other(&oil, nil, false, 0.5), other(&insurance, nil, true, 0.3)}, LevelGroup,
+			[]ClassLabel{{"Insurance", true, 0.3}, {"Banks", false, 1}, {"Oil", false, 0.5}}},
+		{"same label merged", []CompanyClasses{other(nil, &reinsurance, false, 3), other(&insurance, nil, true, 0.2)},
+			LevelGroup, []ClassLabel{{"Insurance", true, 3}, {"Banks", false, 1}}},
+		{"merged at general level", []CompanyClasses{other(&insurance, nil, false, 2), other(&oil, nil, false, 0.5)},
+			LevelBusiness, []ClassLabel{{"Financials", true, 2}, {"Energy", false, 0.5}}},
+		{"unknown class skipped", []CompanyClasses{other(&missing, nil, true, 5)}, LevelGroup,
+			[]ClassLabel{{"Banks", false, 1}}},
+	}
+	taxonomy := testTaxonomy()
+	for _, test := range tests {
+		c := Companies{URL: "bank.com", IndustryGroupID: &banks, OtherClasses: test.others}
+		labels := taxonomy.CompanyLabels(c, test.level)
+		if !reflect.DeepEqual(labels, test.want) {
+			t.Errorf("%v: labels %+v, want %+v", test.name, labels, test.want)
+		}
+		if c = taxonomy.Classify(c, test.level); c.Class != test.want[0].Class {
+			t.Errorf("%v: class %q, want %q", test.name, c.Class, test.want[0].Class)
+		}
+	}
+	if labels := taxonomy.CompanyLabels(Companies{URL: "none.com"}, LevelGroup); len(labels) != 0 {
+		t.Errorf("labels of company without classes: %+v", labels)
+	}
+}
+
+func TestCompanyClasses(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		banks, oil, insurance := IndustryGroups{IndustryGroups: "Banks"}, IndustryGroups{IndustryGroups: "Oil"},
+			IndustryGroups{IndustryGroups: "Insurance"}
+		for _, group := range []*IndustryGroups{&banks, &oil, &insurance} {
+			if err := db.Create(group).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		c := Companies{URL: "bank.com", IndustryGroupID: &banks.ID}
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, other := range []CompanyClasses{
+			{CompanyID: c.ID, IndustryGroupID: &oil.ID, Weight: 0.5},
+			{CompanyID: c.ID, IndustryGroupID: &insurance.ID, IsPrimary: true, Weight: 0.8},
+		} {
+			if err := db.Create(&other).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		companies := db.GetCompanies()
+		want := []ClassLabel{{"Insurance", true, 0.8}, {"Banks", false, 1}, {"Oil", false, 0.5}}
+		if len(companies) != 1 || !reflect.DeepEqual(companies[0].Labels, want) || companies[0].Class != "Insurance" {
+			t.Fatalf("companies = %+v, want labels %+v", companies, want)
+		}
+	})
+}
+
+func TestImportTaxonomy(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *Database) {
+		def := TaxonomyDefinition{Name: "sectors", Classes: []ClassDefinition{
+			{Level: LevelEconomic, Code: "50", Name: "Energy"},
+			{Level: LevelBusiness, Code: "5010", Name: "Fossil Fuels", Parent: "50"},
+			{Level: LevelGroup, Code: "501010", Name: "Oil & Gas", Parent: "5010"},
+			{Level: LevelIndustry, Name: "Oil Exploration", Parent: "Oil & Gas"}}}
+		if err := db.ImportTaxonomy(def); err != nil {
+			t.Fatal(err)
+		}
+		// Repeated import with renamed class updates it by code
+		def.Classes[2].Name = "Oil, Gas & Coal"
+		def.Classes[3].Parent = "501010"
+		if err := db.ImportTaxonomy(def); err != nil {
+			t.Fatal(err)
+		}
+		industry := Industries{}
+		db.Where("industry = ?", "Oil Exploration").First(&industry)
+		if err := db.Create(&Companies{URL: "oil.com", IndustryID: &industry.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.ResolveCompanies(); err != nil {
+			t.Fatal(err)
+		}
+		company := Companies{}
+		db.Where("url = ?", "oil.com").First(&company)
+		labels := db.GetTaxonomy().Labels(company)
+		want := map[string]string{LevelEconomic: "Energy", LevelBusiness: "Fossil Fuels",
+			LevelGroup: "Oil, Gas & Coal", LevelIndustry: "Oil Exploration"}
+		for level, label := range want {
+			if labels[level] != label {
+				t.Errorf("label at level %v is %q, want %q", level, labels[level], label)
+			}
+		}
+		groups := 0
+		db.Model(&IndustryGroups{}).Count(&groups)
+		if groups != 1 {
+			t.Errorf("industry groups after repeated import: %v, want 1", groups)
+		}
+
+		tests := []struct {
+			name    string
+			classes []ClassDefinition
+			message string
+		}{
+			{"duplicate code", []ClassDefinition{{Level: LevelEconomic, Code: "50", Name: "Energy"},
+				{Level: LevelEconomic, Code: "50", Name: "Utilities"}}, "duplicate code 50"},
+			{"duplicate name", []ClassDefinition{{Level: LevelIndustry, Code: "1", Name: "Banks"},
+				{Level: LevelIndustry, Code: "2", Name: "Banks"}}, "duplicate class Banks"},
+			{"unknown level", []ClassDefinition{{Level: "sector", Name: "Energy"}}, "unknown level"},
+			{"no name", []ClassDefinition{{Level: LevelIndustry, Code: "10"}}, "has no name"},
+			{"missing parent", []ClassDefinition{{Level: LevelEconomic, Name: "Energy"},
+				{Level: LevelBusiness, Name: "Fossil Fuels", Parent: "Utilities"}}, "parent Utilities"},
+			{"parent of economic sector", []ClassDefinition{{Level: LevelEconomic, Name: "Energy", Parent: "All"}},
+				"parent All"},
+		}
+		for _, test := range tests {
+			err := db.ImportTaxonomy(TaxonomyDefinition{Name: test.name, Classes: test.classes})
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("%v: error %v, want %q", test.name, err, test.message)
+			}
+		}
+		// The same codes can be used at different levels and in different taxonomies
+		same := TaxonomyDefinition{Name: "topics", Classes: []ClassDefinition{
+			{Level: LevelEconomic, Code: "50", Name: "Energy"},
+			{Level: LevelIndustry, Code: "50", Name: "Energy"}}}
+		if err := db.ImportTaxonomy(same); err != nil {
+			t.Error(err)
+		}
+	})
+}
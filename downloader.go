@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errRejected ... Download failed in a way that will not change on retry
+var errRejected = errors.New("rejected")
+
+// Downloader ... Downloads files over HTTP with timeouts, retries and resume of interrupted transfers
+type Downloader struct {
+	Client      *http.Client
+	ReadTimeout time.Duration
+	Retries     int
+	Backoff     time.Duration
+	MaxBytes    int64
+}
+
+// DownloadResult ... Information about downloaded file
+type DownloadResult struct {
+	Path      string
+	Size      int64
+	SHA256    string
+	MIME      string
+	Extension string
+	Truncated bool
+	Status    int
+	Header    http.Header
+}
+
+// NewDownloader ... Creates downloader, `maxBytes` <= 0 means no size limit
+func NewDownloader(connectTimeout time.Duration, readTimeout time.Duration, retries int, maxBytes int64) *Downloader {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+	}
+	return &Downloader{
+		Client:      &http.Client{Transport: transport},
+		ReadTimeout: readTimeout,
+		Retries:     retries,
+		Backoff:     time.Second * 2,
+		MaxBytes:    maxBytes,
+	}
+}
+
+// Download ... Saves file from `url` into `saveto` folder. If `extension` is set, then content of
+// the file must not be HTML page, since servers often return error pages instead of documents
+func (dl *Downloader) Download(url string, saveto string, extension string) (DownloadResult, error) {
+	result := DownloadResult{}
+	filename := EscapeURL(url)
+	partial := path.Join(saveto, filename+".part")
+	defer os.Remove(partial)
+
+	var err error
+	for attempt := 0; attempt <= dl.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(dl.Backoff * time.Duration(1<<uint(attempt-1)))
+		}
+		err = dl.fetch(url, partial, &result)
+		if err == nil || errors.Is(err, errRejected) {
+			break
+		}
+	}
+	if err != nil {
+		return result, fmt.Errorf("[Download] %v: %w", url, err)
+	}
+
+	if err = dl.inspect(partial, &result); err != nil {
+		return result, fmt.Errorf("[Download] %v: %v", url, err)
+	}
+	if extension != "" && extension != ".html" && result.Extension == ".html" {
+		return result, fmt.Errorf("[Download] %v: %w: HTML page instead of %v", url, errRejected, extension)
+	}
+
+	// Complete file appears under its name only after content is on disk
+	if err = syncFile(partial); err != nil {
+		return result, fmt.Errorf("[Download] %v: %v", url, err)
+	}
+	result.Path = uniqueFilename(path.Join(saveto, filename))
+	if err = os.Rename(partial, result.Path); err != nil {
+		return result, fmt.Errorf("[Download] %v: %v", url, err)
+	}
+	return result, nil
+}
+
+// fetch ... Makes one download attempt appending to already loaded part of file if server supports ranges
+func (dl *Downloader) fetch(url string, partial string, result *DownloadResult) error {
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	if dl.MaxBytes > 0 && offset >= dl.MaxBytes {
+		result.Truncated = true
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", randomOption(userAgents))
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := dl.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	result.Status = resp.StatusCode
+	result.Header = resp.Header
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Everything is already loaded
+		return nil
+	case resp.StatusCode == http.StatusOK:
+		// Server ignored range, so start from the beginning
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("status %v", resp.Status)
+	default:
+		return fmt.Errorf("%w: status %v", errRejected, resp.Status)
+	}
+
+	out, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	defer out.Close()
+
+	// Cancel the request if server stops sending data
+	var body io.Reader = resp.Body
+	if dl.ReadTimeout > 0 {
+		timer := time.AfterFunc(dl.ReadTimeout, cancel)
+		defer timer.Stop()
+		body = &idleReader{reader: resp.Body, timer: timer, timeout: dl.ReadTimeout}
+	}
+
+	if dl.MaxBytes <= 0 {
+		_, err = io.Copy(out, body)
+		return err
+	}
+
+	limit := dl.MaxBytes - offset
+	_, err = io.CopyN(out, body, limit)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Limit is reached, check whether something left unread
+	n, _ := body.Read(make([]byte, 1))
+	result.Truncated = n > 0
+	return nil
+}
+
+// inspect ... Fills size, checksum and detected type of downloaded file
+func (dl *Downloader) inspect(filename string, result *DownloadResult) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	result.MIME = http.DetectContentType(head[:n])
+	result.Extension = ExtensionByMIME(result.MIME)
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	result.Size, err = io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// idleReader ... Postpones timer on each successful read
+type idleReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// uniqueFilename ... Adds sequential number to the name if file already exists
+func uniqueFilename(filename string) string {
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return filename
+		}
+		filename = fmt.Sprintf("%v_%d%v", base, i, ext)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	d "./db"
+	"./storage"
+)
+
+// Content of downloaded test file
+const pdfContent = "%PDF-1.4 annual report of company"
+
+// countingServer ... Starts test server which passes number of request to handler
+func countingServer(handler func(w http.ResponseWriter, r *http.Request, attempt int)) (*httptest.Server, *int) {
+	var mutex sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		attempt := requests
+		mutex.Unlock()
+		handler(w, r, attempt)
+	}))
+	return server, &requests
+}
+
+func testDownloader(maxBytes int64) *Downloader {
+	dl := NewDownloader(time.Second, time.Second, 2, maxBytes)
+	dl.Backoff = time.Millisecond
+	return dl
+}
+
+func TestDownloadTruncated(t *testing.T) {
+	server, _ := countingServer(func(w http.ResponseWriter, r *http.Request, attempt int) {
+		w.Write([]byte(pdfContent))
+	})
+	defer server.Close()
+
+	file, err := testDownloader(10).Download(server.URL+"/report.pdf", t.TempDir(), ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(file.Path)
+	if !file.Truncated || file.Size != 10 || string(content) != pdfContent[:10] {
+		t.Fatalf("download %+v: %q", file, content)
+	}
+	file, err = testDownloader(int64(len(pdfContent))).Download(server.URL+"/full.pdf", t.TempDir(), ".pdf")
+	if err != nil || file.Truncated || file.Size != int64(len(pdfContent)) {
+		t.Fatalf("download of file which fits limit %+v: %v", file, err)
+	}
+}
+
+func TestDownloadRejectsHTML(t *testing.T) {
+	server, requests := countingServer(func(w http.ResponseWriter, r *http.Request, attempt int) {
+		w.Write([]byte("<html><body>File not found</body></html>"))
+	})
+	defer server.Close()
+
+	dir := t.TempDir()
+	if _, err := testDownloader(0).Download(server.URL+"/report.pdf", dir, ".pdf"); !errors.Is(err, errRejected) {
+		t.Fatalf("Download = %v", err)
+	}
+	if *requests != 1 {
+		t.Fatalf("rejected page is requested %v times", *requests)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Fatalf("files left: %v", files)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	ranges := []string{}
+	server, _ := countingServer(func(w http.ResponseWriter, r *http.Request, attempt int) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if attempt == 1 {
+			// Connection breaks in the middle of file
+			w.Header().Set("Content-Length", "33")
+			w.Write([]byte(pdfContent[:12]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("Content-Range", "bytes 12-32/33")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(pdfContent[12:]))
+	})
+	defer server.Close()
+
+	file, err := testDownloader(0).Download(server.URL+"/report.pdf", t.TempDir(), ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(file.Path)
+	if string(content) != pdfContent || file.SHA256 != contentHash(content) || file.Status != http.StatusPartialContent {
+		t.Fatalf("download %+v: %q", file, content)
+	}
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=12-" {
+		t.Fatalf("ranges = %q", ranges)
+	}
+}
+
+func TestDownloadRetries(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		failures int
+		status   int
+		requests int
+		failed   bool
+	}{
+		{"server error is retried", 2, http.StatusServiceUnavailable, 3, false},
+		{"rate limit is retried", 1, http.StatusTooManyRequests, 2, false},
+		{"all attempts fail", 5, http.StatusBadGateway, 3, true},
+		{"missing file is not retried", 5, http.StatusNotFound, 1, true},
+	} {
+		server, requests := countingServer(func(w http.ResponseWriter, r *http.Request, attempt int) {
+			if attempt <= test.failures {
+				http.Error(w, "failure", test.status)
+				return
+			}
+			w.Write([]byte(pdfContent))
+		})
+		file, err := testDownloader(0).Download(server.URL+"/report.pdf", t.TempDir(), ".pdf")
+		server.Close()
+		if (err != nil) != test.failed || *requests != test.requests {
+			t.Errorf("%v: %v requests, error %v", test.name, *requests, err)
+		} else if !test.failed && file.Size != int64(len(pdfContent)) {
+			t.Errorf("%v: download %+v", test.name, file)
+		}
+	}
+}
+
+func TestSaveTruncated(t *testing.T) {
+	server, _ := countingServer(func(w http.ResponseWriter, r *http.Request, attempt int) {
+		w.Write([]byte(pdfContent))
+	})
+	defer server.Close()
+	file, err := testDownloader(10).Download(server.URL+"/report.pdf", t.TempDir(), ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	name, err := store.SaveDownloaded(d.Documents{CompanyID: 1, Crawler: "google", URL: server.URL + "/report.pdf"}, file,
+		"google/Tech/a.com/report.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if documents := memory.GetDocuments(); len(documents) != 1 || !documents[0].Truncated {
+		t.Fatalf("documents = %+v", documents)
+	}
+	content, err := store.Storage.Get(name + metaSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := Metadata{}
+	if err = json.Unmarshal(content, &meta); err != nil || !meta.Truncated || meta.Size != 10 {
+		t.Fatalf("sidecar %s: %v", content, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	d "./db"
+)
+
+// exportRecord ... Line of dataset manifest describing one exported document
+type exportRecord struct {
+	File       string            `json:"file"`
+	URL        string            `json:"url"`
+	Company    string            `json:"company"`
+	Class      string            `json:"class"`
+	Labels     map[string]string `json:"labels"`
+	Classes    []d.ClassLabel    `json:"classes"`
+	Links      []string          `json:"links,omitempty"`
+	Crawler    string            `json:"crawler"`
+	Snapshot   string            `json:"snapshot,omitempty"`
+	CapturedAt time.Time         `json:"captured_at"`
+	SHA256     string            `json:"sha256"`
+	Truncated  bool              `json:"truncated,omitempty"`
+}
+
+// exportName ... Returns name of exported document in folder of class. Documents of the same URL found by different
+// crawlers or in different periods are kept apart by subfolders, so file name stays URL of document
+func exportName(exportPath string, class string, c d.Companies, doc d.Documents) string {
+	return path.Join(exportPath, class, url.PathEscape(c.URL), doc.Crawler, doc.Period, path.Base(doc.Path))
+}
+
+// Export ... Copies collected documents into dataset folder of storage grouped by class of configured taxonomy level
+// and writes manifest in JSONL format with labels of all levels. Companies of several classes are exported into folder
+// of primary class, and linked into folders of other classes if configured
+func (m Miner) Export(config exportConfig) error {
+	level := config.ClassLevel
+	if level == "" {
+		level = m.db.GetClassLevel()
+	}
+	taxonomy := m.db.GetTaxonomy()
+
+	var manifest bytes.Buffer
+	encoder := json.NewEncoder(&manifest)
+
+	companies := map[int]d.Companies{}
+	for _, c := range m.db.GetCompanies() {
+		companies[c.ID] = c
+	}
+
+	exported := map[string]struct{}{}
+	count := 0
+	for _, doc := range m.db.GetDocuments() {
+		if _, found := exported[doc.Hash]; config.UniqueOnly && found && doc.Hash != "" {
+			continue
+		}
+		if config.DropNearDuplicates && isDuplicate(doc) {
+			continue
+		}
+		c, found := companies[doc.CompanyID]
+		if !found {
+			continue
+		}
+
+		// Read through references of content-addressed storage
+		content, err := m.store.Storage.Get(doc.Path)
+		if err != nil {
+			fmt.Printf("[Export] skipped %v: %v\n", doc.Path, err)
+			continue
+		}
+
+		labels := taxonomy.CompanyLabels(c, level)
+		class := ""
+		if len(labels) > 0 {
+			class = labels[0].Class
+		}
+		filename := exportName(config.Path, class, c, doc)
+		if err = m.store.Storage.Put(filename, bytes.NewReader(content), int64(len(content))); err != nil {
+			return fmt.Errorf("[Export] error: %v", err)
+		}
+		links := []string{}
+		for i := 1; config.LinkClasses && i < len(labels); i++ {
+			link := exportName(config.Path, labels[i].Class, c, doc)
+			linked, err := m.store.Storage.Exists(link)
+			if err == nil && !linked {
+				err = m.store.Storage.Link(filename, link)
+			}
+			if err != nil {
+				return fmt.Errorf("[Export] error: %v", err)
+			}
+			links = append(links, link)
+		}
+
+		record := exportRecord{File: filename, URL: doc.URL, Company: c.URL, Class: class,
+			Labels: taxonomy.Labels(c), Classes: labels, Links: links, Crawler: doc.Crawler,
+			Snapshot: doc.Snapshot, CapturedAt: doc.CapturedAt, SHA256: doc.Hash,
+			Truncated: doc.Truncated}
+		if err = encoder.Encode(record); err != nil {
+			return fmt.Errorf("[Export] error: %v", err)
+		}
+		exported[doc.Hash] = struct{}{}
+		count++
+	}
+
+	err := m.store.Storage.Put(path.Join(config.Path, "manifest.jsonl"), &manifest, int64(manifest.Len()))
+	if err != nil {
+		return fmt.Errorf("[Export] error: %v", err)
+	}
+	fmt.Println("Exported documents: ", count)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	d "./db"
+	"./storage"
+)
+
+// exportedRecords ... Runs export and reads records of its manifest
+func exportedRecords(t *testing.T, m Miner, config exportConfig) []exportRecord {
+	if err := m.Export(config); err != nil {
+		t.Fatal(err)
+	}
+	content, err := m.store.Storage.Get(config.Path + "/manifest.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []exportRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		record := exportRecord{}
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestExport(t *testing.T) {
+	memory := classifiedMemory()
+	store := NewDocumentStore(storageConfig{ContentAddressed: true, Blobs: "blobs"}, storage.NewLocal(t.TempDir()), memory)
+	m := Miner{db: memory, store: store}
+	report := []byte("%PDF-1.4 annual report")
+	for _, doc := range []struct {
+		companyID int
+		name      string
+		content   []byte
+	}{
+		{1, "common/Banks/a.com/report.pdf", report},
+		{3, "common/Oil/c.com/report.pdf", report},
+		{3, "colly/Oil/c.com/index.html", []byte("<html>Oil</html>")},
+	} {
+		if _, err := store.Save(d.Documents{CompanyID: doc.companyID, Crawler: "common", URL: "http://" + doc.name}, doc.content,
+			doc.name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := exportedRecords(t, m, exportConfig{Path: "dataset"})
+	if len(records) != 3 {
+		t.Fatalf("records = %+v", records)
+	}
+	if r := records[0]; r.File != "dataset/Banks/a.com/common/report.pdf" || r.Company != "a.com" || r.Class != "Banks" ||
+		r.URL != "http://common/Banks/a.com/report.pdf" || r.SHA256 != contentHash(report) || r.Labels[d.LevelGroup] != "Banks" {
+		t.Fatalf("record = %+v", r)
+	}
+	for _, r := range records {
+		if content, err := store.Storage.Get(r.File); err != nil || contentHash(content) != r.SHA256 {
+			t.Fatalf("exported %v: %v", r.File, err)
+		}
+	}
+
+	// Repeated content is exported once
+	records = exportedRecords(t, m, exportConfig{Path: "unique", UniqueOnly: true})
+	if len(records) != 2 || records[0].Company != "a.com" || records[1].File != "unique/Oil/c.com/common/index.html" {
+		t.Fatalf("unique records = %+v", records)
+	}
+}
+
+func TestExportLinkClasses(t *testing.T) {
+	banks, oil, insurance := 1, 2, 3
+	taxonomy := &d.Taxonomy{Groups: map[int]d.IndustryGroups{
+		banks:     {ID: banks, IndustryGroups: "Banks"},
+		oil:       {ID: oil, IndustryGroups: "Oil"},
+		insurance: {ID: insurance, IndustryGroups: "Insurance"},
+	}}
+	memory := d.NewMemory([]d.Companies{{URL: "a.com", IndustryGroupID: &banks, OtherClasses: []d.CompanyClasses{
+		{IndustryGroupID: &oil, Weight: 0.5},
+		{IndustryGroupID: &insurance, Weight: 2},
+	}}, {URL: "b.com", IndustryGroupID: &banks, OtherClasses: []d.CompanyClasses{
+		{IndustryGroupID: &oil, IsPrimary: true, Weight: 0.7},
+	}}}, taxonomy)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	m := Miner{db: memory, store: store}
+	for i, site := range []string{"a.com", "b.com"} {
+		doc := d.Documents{CompanyID: i + 1, Crawler: "colly", URL: "http://" + site + "/index.html"}
+		if _, err := store.Save(doc, []byte("<html>"+site+"</html>"), "colly/"+site+"/index.html", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := exportedRecords(t, m, exportConfig{Path: "dataset", LinkClasses: true})
+	if len(records) != 2 {
+		t.Fatalf("records = %+v", records)
+	}
+	a, b := records[0], records[1]
+	// Primary class goes first and gets the file, other classes are linked in order of weight
+	wantClasses := []d.ClassLabel{{Class: "Banks", Primary: true, Weight: 1}, {Class: "Insurance", Weight: 2},
+		{Class: "Oil", Weight: 0.5}}
+	wantLinks := []string{"dataset/Insurance/a.com/colly/index.html", "dataset/Oil/a.com/colly/index.html"}
+	if a.File != "dataset/Banks/a.com/colly/index.html" || a.Class != "Banks" ||
+		!reflect.DeepEqual(a.Classes, wantClasses) || !reflect.DeepEqual(a.Links, wantLinks) {
+		t.Errorf("record of a.com = %+v", a)
+	}
+	if b.File != "dataset/Oil/b.com/colly/index.html" || b.Class != "Oil" ||
+		!reflect.DeepEqual(b.Links, []string{"dataset/Banks/b.com/colly/index.html"}) {
+		t.Errorf("record of b.com = %+v", b)
+	}
+	for _, r := range records {
+		original, err := store.Storage.Get(r.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, link := range r.Links {
+			if linked, err := store.Storage.Get(link); err != nil || !bytes.Equal(linked, original) {
+				t.Errorf("link %v: %q, %v", link, linked, err)
+			}
+		}
+	}
+
+	// Repeated export keeps existing links
+	if records = exportedRecords(t, m, exportConfig{Path: "dataset", LinkClasses: true}); len(records[0].Links) != 2 {
+		t.Errorf("links of repeated export = %v", records[0].Links)
+	}
+
+	records = exportedRecords(t, m, exportConfig{Path: "flat"})
+	if len(records[0].Links) != 0 || len(records[0].Classes) != 3 {
+		t.Errorf("record without links = %+v", records[0])
+	}
+	if linked, _ := store.Storage.Exists("flat/Oil/a.com/colly/index.html"); linked {
+		t.Error("document is linked into other class without link_classes")
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	d "./db"
 	"github.com/PuerkitoBio/goquery"
 )
 
@@ -15,9 +18,30 @@ type GoogleResultChan struct {
 	URL      string
 	Progress int
 	Total    int
+	File     string
+	Checksum string
 	Warning  error
 	Error    error
 	Done     bool
+	Stopped  bool
+	Skipped  bool
+}
+
+// GoogleConfig ... Holds configuration parameters for Google crawler
+type GoogleConfig struct {
+	ResChanel    chan GoogleResultChan
+	Extension    string
+	Downloader   *Downloader
+	TempDir      string
+	Archive      *Archiver
+	Store        *DocumentStore
+	Industry     string
+	CompanyID    int
+	Domains      []string
+	MaxResults   int
+	PageInterval time.Duration
+	DB           d.Repository
+	CacheTTL     time.Duration
 }
 
 // GoogleResult ... Result of Google search
@@ -44,16 +68,25 @@ var userAgents = []string{
 	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_13) AppleWebKit/604.1.38 (KHTML, like Gecko) Version/11.0 Safari/604.1.38",
 }
 
-func buildGoogleURL(searchTerm string, countryCode string, languageCode string) string {
+// Google returns at most 100 results per page and often ignores `num` at all
+const googlePageSize = 100
+
+func buildGoogleURL(searchTerm string, countryCode string, languageCode string, start int) string {
 	searchTerm = strings.Trim(searchTerm, " ")
 	searchTerm = strings.Replace(searchTerm, " ", "+", -1)
-	if googleBase, found := googleDomains[countryCode]; found {
-		return fmt.Sprintf("%s%s&num=100&hl=%s", googleBase, searchTerm, languageCode)
+	googleBase, found := googleDomains[countryCode]
+	if !found {
+		googleBase = googleDomains["com"]
 	}
-	return fmt.Sprintf("%s%s&num=100&hl=%s", googleDomains["com"], searchTerm, languageCode)
-
+	if start > 0 {
+		return fmt.Sprintf("%s%s&num=%d&hl=%s&start=%d", googleBase, searchTerm, googlePageSize, languageCode, start)
+	}
+	return fmt.Sprintf("%s%s&num=%d&hl=%s", googleBase, searchTerm, googlePageSize, languageCode)
 }
 
+// errGoogleBlocked ... Returned when Google answers with captcha or rate limit instead of results
+var errGoogleBlocked = errors.New("search is blocked by Google")
+
 func googleRequest(searchURL string) (*http.Response, error) {
 	baseClient := &http.Client{}
 	req, _ := http.NewRequest("GET", searchURL, nil)
@@ -64,15 +97,33 @@ func googleRequest(searchURL string) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			return nil, fmt.Errorf("[googleRequest] %w: %v", errGoogleBlocked, res.Status)
+		}
+		return nil, fmt.Errorf("[googleRequest] bad status: %v", res.Status)
+	}
 	return res, nil
 
 }
 
+// isCaptcha ... Checks whether page is Google check for unusual traffic instead of search results
+func isCaptcha(doc *goquery.Document) bool {
+	if doc.Find("form#captcha-form, div.g-recaptcha").Length() > 0 {
+		return true
+	}
+	return strings.Contains(doc.Url.Path, "/sorry/") || strings.Contains(doc.Find("body").Text(), "unusual traffic")
+}
+
 func googleResultParser(response *http.Response) ([]GoogleResult, error) {
 	doc, err := goquery.NewDocumentFromResponse(response)
 	if err != nil {
 		return nil, err
 	}
+	if isCaptcha(doc) {
+		return nil, fmt.Errorf("[googleResultParser] %w: captcha", errGoogleBlocked)
+	}
 	results := []GoogleResult{}
 	sel := doc.Find("div.g")
 	rank := 1
@@ -99,9 +150,8 @@ func googleResultParser(response *http.Response) ([]GoogleResult, error) {
 	return results, err
 }
 
-// GoogleScrape ...
-func GoogleScrape(searchTerm string, countryCode string, languageCode string) ([]GoogleResult, error) {
-	googleURL := buildGoogleURL(searchTerm, countryCode, languageCode)
+func googleScrapePage(searchTerm string, countryCode string, languageCode string, start int) ([]GoogleResult, error) {
+	googleURL := buildGoogleURL(searchTerm, countryCode, languageCode, start)
 
 	res, err := googleRequest(googleURL)
 
@@ -116,65 +166,178 @@ func GoogleScrape(searchTerm string, countryCode string, languageCode string) ([
 
 }
 
-// DownloadFile will download a url to a local file. It's efficient because it will
-// write as it downloads and not load the whole file into memory.
-func DownloadFile(saveto string, extension string, url string, maxMegabytes uint64) error {
+// GoogleScrape ... Walks through result pages of search query until `maxResults` is collected.
+// Stops earlier if a page is empty or contains only already seen links
+func GoogleScrape(searchTerm string, countryCode string, languageCode string, maxResults int, pageInterval time.Duration) ([]GoogleResult, error) {
+	return scrapePages(maxResults, pageInterval, func(start int) ([]GoogleResult, error) {
+		return googleScrapePage(searchTerm, countryCode, languageCode, start)
+	})
+}
 
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+// scrapePages ... Collects results from pages returned by `page` for offset of the first result on page
+func scrapePages(maxResults int, pageInterval time.Duration, page func(start int) ([]GoogleResult, error)) ([]GoogleResult, error) {
+	if maxResults <= 0 {
+		maxResults = googlePageSize
 	}
-	defer resp.Body.Close()
+	results := []GoogleResult{}
+	seen := map[string]struct{}{}
 
-	filename := saveto + "/" + FilenameFromURL(url)
-	// Create the file
-	var out *os.File
-	if _, err := os.Stat(filename); err == nil {
-		out, err = os.Create(filename + randString(10) + "." + extension)
+	for start := 0; len(results) < maxResults; {
+		found, err := page(start)
 		if err != nil {
-			return err
+			return results, fmt.Errorf("[GoogleScrape] page from %v: %w", start, err)
 		}
-	} else {
-		out, err = os.Create(filename)
-		if err != nil {
-			return err
+		if len(found) == 0 {
+			break
+		}
+
+		added := 0
+		for _, r := range found {
+			if _, found := seen[r.ResultURL]; found {
+				continue
+			}
+			seen[r.ResultURL] = struct{}{}
+			r.ResultRank = len(results) + 1
+			results = append(results, r)
+			added++
+			if len(results) == maxResults {
+				break
+			}
+		}
+		// Google repeats the last page when `start` goes beyond available results
+		if added == 0 {
+			break
+		}
+
+		// Page size is not guaranteed, so next page starts after actually received amount
+		start += len(found)
+		time.Sleep(pageInterval)
+	}
+	return results, nil
+}
+
+// cachedGoogleScrape ... Returns results of query from database cache if they are not expired,
+// otherwise searches in Google and caches results. Cache is disabled if `CacheTTL` is 0
+func cachedGoogleScrape(query string, config GoogleConfig) ([]GoogleResult, error) {
+	useCache := config.DB != nil && config.CacheTTL > 0
+	if useCache {
+		if cached, found := config.DB.GetSearch(query, config.CacheTTL); found {
+			results := []GoogleResult{}
+			for _, r := range cached {
+				results = append(results, GoogleResult{r.Rank, r.URL, r.Title, r.Description})
+			}
+			return results, nil
 		}
 	}
-	defer out.Close()
 
-	// Write the body to file
-	//_, err = io.Copy(out, resp.Body)
-	megabytes := int64(maxMegabytes * 1024000)
-	_, err = io.CopyN(out, resp.Body, megabytes)
+	results, err := GoogleScrape(query, "ru", "RU", config.MaxResults, config.PageInterval)
+	// Do not cache incomplete or empty results, so query will be repeated next time
+	if err != nil || !useCache || len(results) == 0 {
+		return results, err
+	}
+
+	cached := []d.SearchResults{}
+	for _, r := range results {
+		cached = append(cached, d.SearchResults{Rank: r.ResultRank, URL: r.ResultURL, Title: r.ResultTitle, Description: r.ResultDesc})
+	}
+	if err := config.DB.SaveSearch(query, cached); err != nil {
+		return results, fmt.Errorf("[cachedGoogleScrape] cache save error: %v", err)
+	}
+	return results, nil
+}
+
+// archiveDownload ... Writes downloaded file into WARC archive
+func archiveDownload(fileURL string, file DownloadResult, config GoogleConfig) error {
+	payload, err := ioutil.ReadFile(file.Path)
 	if err != nil {
 		return err
 	}
-	return err
+	// Resumed download ends with partial response, but the whole file is archived
+	status, header := file.Status, file.Header
+	if status == http.StatusPartialContent {
+		status = http.StatusOK
+		header = http.Header{}
+		for k, v := range file.Header {
+			header[k] = v
+		}
+		header.Del("Content-Range")
+	}
+	return config.Archive.WriteExchange("google", config.Industry, fileURL, nil, status, header, payload)
 }
 
-// FetchURLFiles ...
-func FetchURLFiles(url string, extension string, saveto string, maxMegabytes uint64, resultChan chan GoogleResultChan) {
-	// Query google with filter
-	query := fmt.Sprintf("site:%v filetype:%v", url, extension)
-	res, err := GoogleScrape(query, "ru", "RU")
-	if err != nil {
-		resultChan <- GoogleResultChan{Error: fmt.Errorf("[FetchURLFiles] error: %v", err), URL: url}
+// FetchURLFiles ... Searches files of given site and additional domains of company in Google and downloads them.
+// Files are loaded into local temporary folder and then moved into `saveto` folder of storage
+func FetchURLFiles(url string, saveto string, config GoogleConfig) {
+	resultChan := config.ResChanel
+	extension := config.Extension
+	if err := config.Store.Check(config.CompanyID); err != nil {
+		resultChan <- GoogleResultChan{Warning: err, URL: url}
+		resultChan <- GoogleResultChan{URL: url, Done: true, Stopped: true}
 		return
 	}
 
+	// Query google with filter for each domain
+	res := []GoogleResult{}
+	seen := map[string]struct{}{}
+	var err error
+	for _, site := range append([]string{url}, config.Domains...) {
+		query := fmt.Sprintf("site:%v filetype:%v", site, extension)
+		found, searchErr := cachedGoogleScrape(query, config)
+		if searchErr != nil {
+			// Some pages could be collected before failure, so proceed with them
+			err = searchErr
+			resultChan <- GoogleResultChan{Warning: fmt.Errorf("[FetchURLFiles] error: %v", err), URL: url}
+		}
+		for _, r := range found {
+			if _, found := seen[r.ResultURL]; !found {
+				seen[r.ResultURL] = struct{}{}
+				res = append(res, r)
+			}
+		}
+	}
+
 	if len(res) == 0 {
 		resultChan <- GoogleResultChan{Error: fmt.Errorf("[FetchURLFiles] no results found: %v", err), URL: url}
 		return
 	}
 	// Download found files
 	for i, r := range res {
-		DownloadFile(saveto, extension, r.ResultURL, maxMegabytes)
+		if err := config.Store.Check(config.CompanyID); err != nil {
+			resultChan <- GoogleResultChan{Warning: err, URL: url}
+			resultChan <- GoogleResultChan{URL: url, Done: true, Stopped: true}
+			return
+		}
+		file, err := config.Downloader.Download(r.ResultURL, config.TempDir, "."+extension)
 		if err != nil {
 			resultChan <- GoogleResultChan{Warning: fmt.Errorf("[FetchURLFiles] error: %v", err), URL: url}
 			continue
 		}
-		resultChan <- GoogleResultChan{URL: url, Total: len(res), Progress: i + 1}
+		if config.Archive != nil {
+			if err = archiveDownload(r.ResultURL, file, config); err != nil {
+				resultChan <- GoogleResultChan{Warning: fmt.Errorf("[FetchURLFiles] error: %v", err), URL: url}
+			}
+		}
+		if file.Truncated {
+			resultChan <- GoogleResultChan{Warning: fmt.Errorf("[FetchURLFiles] file truncated to size limit: %v", file.Path), URL: url}
+		}
+
+		doc := d.Documents{CompanyID: config.CompanyID, Crawler: "google", URL: r.ResultURL}
+		saved, err := config.Store.SaveDownloaded(doc, file, documentName(saveto, r.ResultURL, "."+extension))
+		if errors.Is(err, errQuotaExceeded) {
+			resultChan <- GoogleResultChan{Warning: err, URL: url}
+			resultChan <- GoogleResultChan{URL: url, Done: true, Stopped: true}
+			return
+		} else if err != nil {
+			os.Remove(file.Path)
+			resultChan <- GoogleResultChan{Warning: fmt.Errorf("[FetchURLFiles] error: %v", err), URL: url}
+			continue
+		}
+		resultChan <- GoogleResultChan{URL: url, Total: len(res), Progress: i + 1, File: saved, Checksum: file.SHA256}
+	}
+	// Company with failed search is not finished, so its search is repeated by the next run
+	if err != nil {
+		resultChan <- GoogleResultChan{Error: fmt.Errorf("[FetchURLFiles] search failed: %v", err), URL: url}
+		return
 	}
 	resultChan <- GoogleResultChan{URL: url, Done: true}
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	d "./db"
+	"./storage"
+)
+
+// fakePages ... Returns page source which serves `pages` of links and records offsets it was asked for
+func fakePages(pages [][]string, starts *[]int) func(start int) ([]GoogleResult, error) {
+	return func(start int) ([]GoogleResult, error) {
+		*starts = append(*starts, start)
+		offset := 0
+		for _, links := range pages {
+			if offset == start {
+				results := []GoogleResult{}
+				for i, link := range links {
+					results = append(results, GoogleResult{ResultRank: i + 1, ResultURL: link})
+				}
+				return results, nil
+			}
+			offset += len(links)
+		}
+		// Google repeats the last page beyond available results
+		return fakePages(pages[len(pages)-1:], &[]int{})(0)
+	}
+}
+
+func resultURLs(results []GoogleResult) []string {
+	urls := []string{}
+	for i, r := range results {
+		if r.ResultRank != i+1 {
+			urls = append(urls, fmt.Sprintf("rank %v of %v", r.ResultRank, r.ResultURL))
+			continue
+		}
+		urls = append(urls, r.ResultURL)
+	}
+	return urls
+}
+
+func TestScrapePages(t *testing.T) {
+	pages := [][]string{{"a", "b", "c"}, {"c", "d"}, {"e"}}
+	for _, test := range []struct {
+		name       string
+		pages      [][]string
+		maxResults int
+		results    []string
+		starts     []int
+	}{
+		// Next page starts after received amount, seen links are dropped and ranks continue
+		{"all pages", pages, 10, []string{"a", "b", "c", "d", "e"}, []int{0, 3, 5, 6}},
+		{"limit", pages, 4, []string{"a", "b", "c", "d"}, []int{0, 3}},
+		{"empty page", [][]string{{"a", "b"}, {}}, 10, []string{"a", "b"}, []int{0, 2}},
+		{"no results", [][]string{{}}, 10, []string{}, []int{0}},
+	} {
+		starts := []int{}
+		results, err := scrapePages(test.maxResults, 0, fakePages(test.pages, &starts))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if got := resultURLs(results); !reflect.DeepEqual(got, test.results) || !reflect.DeepEqual(starts, test.starts) {
+			t.Errorf("%v: results %v from %v, want %v from %v", test.name, got, starts, test.results, test.starts)
+		}
+	}
+
+	// Results collected before failed page are returned with error
+	failure := errors.New("connection reset")
+	results, err := scrapePages(10, 0, func(start int) ([]GoogleResult, error) {
+		if start > 0 {
+			return nil, failure
+		}
+		return []GoogleResult{{ResultURL: "a"}}, nil
+	})
+	if err == nil || len(results) != 1 {
+		t.Fatalf("scrapePages = %v, %v", results, err)
+	}
+}
+
+func TestBlockedSearchNotCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch query := r.URL.Query().Get("q"); {
+		case strings.HasPrefix(query, "limited"):
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		case strings.HasPrefix(query, "captcha"):
+			w.Write([]byte(`<html><body><p>Our systems have detected unusual traffic from your computer network.</p>
+				<form id="captcha-form" action="index"><div class="g-recaptcha"></div></form></body></html>`))
+		case strings.HasPrefix(query, "empty"):
+			w.Write([]byte(`<html><body><p>Your search did not match any documents.</p></body></html>`))
+		default:
+			w.Write([]byte(`<html><body><div class="g"><a href="http://a.com/report.pdf"><h3 class="r">Report</h3></a></div></body></html>`))
+		}
+	}))
+	defer server.Close()
+	base := googleDomains["ru"]
+	googleDomains["ru"] = server.URL + "/search?q="
+	defer func() { googleDomains["ru"] = base }()
+
+	memory := d.NewMemory(nil, nil)
+	config := GoogleConfig{DB: memory, CacheTTL: time.Hour, MaxResults: 10}
+	for _, query := range []string{"limited", "captcha"} {
+		if results, err := cachedGoogleScrape(query, config); !errors.Is(err, errGoogleBlocked) || len(results) != 0 {
+			t.Errorf("%v: results %v, error %v", query, results, err)
+		}
+	}
+	if results, err := cachedGoogleScrape("empty", config); err != nil || len(results) != 0 {
+		t.Errorf("empty: results %v, error %v", results, err)
+	}
+	for _, query := range []string{"limited", "captcha", "empty"} {
+		if cached, found := memory.GetSearch(query, time.Hour); found {
+			t.Errorf("%v: %v is cached", query, cached)
+		}
+	}
+
+	if results, err := cachedGoogleScrape("found", config); err != nil || len(results) != 1 {
+		t.Fatalf("found: results %v, error %v", results, err)
+	}
+	if cached, found := memory.GetSearch("found", time.Hour); !found || len(cached) != 1 || cached[0].URL != "http://a.com/report.pdf" {
+		t.Fatalf("cached = %v, %v", cached, found)
+	}
+}
+
+func TestSearchCompanyDomains(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(pdfContent + r.URL.Path))
+	}))
+	defer files.Close()
+	var mutex sync.Mutex
+	queries := []string{}
+	search := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		// All results fit on the first page
+		if r.URL.Query().Get("start") != "" {
+			w.Write([]byte(`<html><body></body></html>`))
+			return
+		}
+		mutex.Lock()
+		queries = append(queries, query)
+		mutex.Unlock()
+		// Report of holding is found on both sites
+		links := `<div class="g"><a href="` + files.URL + `/holding.pdf"><h3 class="r">Holding</h3></a></div>`
+		if query == "site:ir.a.com filetype:pdf" {
+			links += `<div class="g"><a href="` + files.URL + `/investors.pdf"><h3 class="r">Investors</h3></a></div>`
+		}
+		w.Write([]byte(`<html><body>` + links + `</body></html>`))
+	}))
+	defer search.Close()
+	base := googleDomains["ru"]
+	googleDomains["ru"] = search.URL + "/search?q="
+	defer func() { googleDomains["ru"] = base }()
+
+	memory := d.NewMemory([]d.Companies{{URL: "a.com", Domains: []string{"ir.a.com"}}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	resChan := make(chan GoogleResultChan)
+	config := GoogleConfig{ResChanel: resChan, Extension: "pdf", Downloader: testDownloader(0), TempDir: t.TempDir(),
+		Store: store, CompanyID: 1, Domains: []string{"ir.a.com"}, MaxResults: 10}
+	go FetchURLFiles("a.com", "google/Tech/a.com", config)
+	for r := range resChan {
+		if r.Error != nil || r.Warning != nil {
+			t.Fatal(r.Error, r.Warning)
+		}
+		if r.Done {
+			break
+		}
+	}
+
+	// Every domain of company is searched, files found on several domains are saved once into company folder
+	if want := []string{"site:a.com filetype:pdf", "site:ir.a.com filetype:pdf"}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %v, want %v", queries, want)
+	}
+	urls := []string{}
+	for _, doc := range memory.GetDocuments() {
+		urls = append(urls, doc.URL)
+		if !strings.HasPrefix(doc.Path, "google/Tech/a.com/") || doc.CompanyID != 1 {
+			t.Errorf("document %+v is not saved for company", doc)
+		}
+	}
+	if want := []string{files.URL + "/holding.pdf", files.URL + "/investors.pdf"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("saved %v, want %v", urls, want)
+	}
+}
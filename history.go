@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	d "./db"
+)
+
+// capturePeriod ... Returns label of period which capture timestamp belongs to, e.g. `2019` for yearly,
+// `2019-Q2` for quarterly and `2019-05` for monthly periods
+func capturePeriod(timestamp string, period string) (string, error) {
+	if len(timestamp) < 6 {
+		return "", fmt.Errorf("[capturePeriod] bad timestamp: %v", timestamp)
+	}
+	year, month := timestamp[:4], timestamp[4:6]
+
+	switch period {
+	case "yearly":
+		return year, nil
+	case "quarterly":
+		m, err := strconv.Atoi(month)
+		if err != nil {
+			return "", fmt.Errorf("[capturePeriod] bad timestamp: %v", timestamp)
+		}
+		return fmt.Sprintf("%v-Q%d", year, (m-1)/3+1), nil
+	case "monthly":
+		return year + "-" + month, nil
+	}
+	return "", fmt.Errorf("[capturePeriod] unknown period: %v", period)
+}
+
+// validPeriod ... Checks period of historical mode, empty period turns it off
+func validPeriod(period string) error {
+	switch period {
+	case "", "yearly", "quarterly", "monthly":
+		return nil
+	}
+	return fmt.Errorf("[validPeriod] unknown period %v, one of yearly, quarterly or monthly is expected", period)
+}
+
+// rootDistance ... Returns how far capture is from main page of site: number of path segments,
+// plus one for query
+func rootDistance(captureURL string) int {
+	u, err := url.Parse(captureURL)
+	if err != nil {
+		return math.MaxInt32
+	}
+	distance := 0
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment != "" {
+			distance++
+		}
+	}
+	if u.RawQuery != "" {
+		distance++
+	}
+	return distance
+}
+
+// closer ... Checks whether capture `a` represents company better than `b`: main page of site or capture closest
+// to it is preferred. Among equally close captures `keep` rule decides
+func closer(a capture, b capture, keep string) bool {
+	da, db := rootDistance(a.URL), rootDistance(b.URL)
+	switch {
+	case da != db:
+		return da < db
+	case len(a.URL) != len(b.URL):
+		return len(a.URL) < len(b.URL)
+	case keep == "oldest":
+		return a.Timestamp < b.Timestamp
+	default:
+		return a.Timestamp > b.Timestamp
+	}
+}
+
+// rankCaptures ... Returns captures in order in which they represent company, the best one goes first
+func rankCaptures(captures []capture, keep string) []capture {
+	ranked := append([]capture{}, captures...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return closer(ranked[i], ranked[j], keep)
+	})
+	return ranked
+}
+
+// periodCaptures ... Splits captures of company into periods and ranks captures of each period, so representative one
+// goes first. Returns ranked captures and their periods in chronological order
+func periodCaptures(captures []capture, period string, keep string) (map[string][]capture, []string, error) {
+	grouped := map[string][]capture{}
+	for _, c := range captures {
+		label, err := capturePeriod(c.Timestamp, period)
+		if err != nil {
+			return nil, nil, err
+		}
+		grouped[label] = append(grouped[label], c)
+	}
+
+	periods := []string{}
+	for label, group := range grouped {
+		grouped[label] = rankCaptures(group, keep)
+		periods = append(periods, label)
+	}
+	sort.Strings(periods)
+	return grouped, periods, nil
+}
+
+// saveCaptures ... Saves captures of company found in web archive. Without `period` captures are merged to one per URL,
+// otherwise one representative capture of company is saved for each period into folder of that period. If capture
+// of period fails to be saved, the next one by rank is tried, but not more than `maxAmount`. `save` is called
+// for each chosen capture with folder and period where it belongs. Returns `true` if saving was stopped by quota
+func saveCaptures(c d.Companies, found [][]capture, saveto string, keep string, period string, maxAmount int,
+	wait time.Duration, resChan chan ArchiveResultChan, save func(capt capture, folder string, period string) error) bool {
+	if period == "" {
+		captures := mergeCaptures(found, keep)
+		if maxAmount > 0 && len(captures) > maxAmount {
+			captures = captures[:maxAmount]
+		}
+		for i, capt := range captures {
+			err := save(capt, saveto, "")
+			if errors.Is(err, errQuotaExceeded) {
+				resChan <- ArchiveResultChan{URL: c.URL, Error: err}
+				return true
+			} else if err != nil && !errors.Is(err, errNotAllowed) {
+				resChan <- ArchiveResultChan{URL: c.URL, Error: err}
+			} else {
+				resChan <- ArchiveResultChan{URL: c.URL, Progress: i + 1, Total: len(captures)}
+			}
+			time.Sleep(wait)
+		}
+		return false
+	}
+
+	flat := []capture{}
+	for _, f := range found {
+		flat = append(flat, f...)
+	}
+	grouped, periods, err := periodCaptures(flat, period, keep)
+	if err != nil {
+		resChan <- ArchiveResultChan{URL: c.URL, Error: err}
+		return false
+	}
+	for i, p := range periods {
+		candidates := grouped[p]
+		if maxAmount > 0 && len(candidates) > maxAmount {
+			candidates = candidates[:maxAmount]
+		}
+		folder := path.Join(saveto, p)
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			resChan <- ArchiveResultChan{URL: c.URL, Error: fmt.Errorf("[saveCaptures] error: %v", err)}
+			continue
+		}
+
+		for _, capt := range candidates {
+			err := save(capt, folder, p)
+			time.Sleep(wait)
+			if errors.Is(err, errQuotaExceeded) {
+				resChan <- ArchiveResultChan{URL: c.URL, Error: err}
+				return true
+			} else if err == nil {
+				resChan <- ArchiveResultChan{URL: c.URL, Progress: i + 1, Total: len(periods)}
+				break
+			} else if !errors.Is(err, errNotAllowed) {
+				resChan <- ArchiveResultChan{URL: c.URL, Error: err}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"./cdx"
+	d "./db"
+)
+
+func TestPeriodCaptures(t *testing.T) {
+	captures := []capture{}
+	for _, c := range []struct{ url, timestamp string }{
+		{"http://a.com/news/2019/report.pdf", "20190105000000"},
+		{"http://a.com/about", "20190301000000"},
+		{"http://a.com/", "20190201000000"},
+		{"http://a.com/", "20190601000000"},
+		{"http://www.a.com/", "20190701000000"},
+		{"http://a.com/about?lang=en", "20200101000000"},
+		{"http://a.com/contacts", "20200301000000"},
+		{"http://a.com/team/ceo", "20200201000000"},
+	} {
+		captures = append(captures, capture{Record: cdx.Record{URL: c.url, Timestamp: c.timestamp}})
+	}
+
+	chosen := func(keep string) map[string]string {
+		grouped, periods, err := periodCaptures(captures, "yearly", keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(periods, []string{"2019", "2020"}) {
+			t.Fatalf("periods = %v", periods)
+		}
+		result := map[string]string{}
+		for p, count := range map[string]int{"2019": 5, "2020": 3} {
+			if len(grouped[p]) != count {
+				t.Fatalf("period %v has %v captures", p, len(grouped[p]))
+			}
+		}
+		for _, p := range periods {
+			result[p] = grouped[p][0].URL + " " + grouped[p][0].Timestamp
+		}
+		return result
+	}
+
+	// Main page represents company, without it the closest page is taken
+	want := map[string]string{"2019": "http://a.com/ 20190601000000", "2020": "http://a.com/contacts 20200301000000"}
+	if got := chosen("newest"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("newest = %v, want %v", got, want)
+	}
+	want["2019"] = "http://a.com/ 20190201000000"
+	if got := chosen("oldest"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("oldest = %v, want %v", got, want)
+	}
+}
+
+func TestValidPeriod(t *testing.T) {
+	for _, period := range []string{"", "yearly", "quarterly", "monthly"} {
+		if err := validPeriod(period); err != nil {
+			t.Errorf("validPeriod(%q) = %v", period, err)
+		}
+	}
+	if err := validPeriod("weekly"); err == nil {
+		t.Error("validPeriod(weekly): error is expected")
+	}
+}
+
+func TestSaveCapturesFallback(t *testing.T) {
+	captures := []capture{}
+	for _, c := range []struct{ url, timestamp string }{
+		{"http://a.com/", "20190601000000"},
+		{"http://a.com/about", "20190301000000"},
+		{"http://a.com/news/report", "20190105000000"},
+		{"http://a.com/team/ceo", "20190201000000"},
+		{"http://a.com/", "20200101000000"},
+		{"http://a.com/about", "20200201000000"},
+	} {
+		captures = append(captures, capture{Record: cdx.Record{URL: c.url, Timestamp: c.timestamp}})
+	}
+	dir := t.TempDir()
+
+	// Main page of 2019 is not in archive and its next capture is not a document, main page of 2020 fills quota
+	tried := []string{}
+	save := func(capt capture, folder string, period string) error {
+		tried = append(tried, period+" "+capt.URL)
+		switch capt.URL + " " + capt.Timestamp {
+		case "http://a.com/ 20190601000000":
+			return errors.New("replay is not found")
+		case "http://a.com/about 20190301000000":
+			return fmt.Errorf("%w: .none", errNotAllowed)
+		case "http://a.com/ 20200101000000":
+			return errQuotaExceeded
+		}
+		if folder != filepath.Join(dir, period) {
+			t.Errorf("capture of %v is saved into %v", period, folder)
+		}
+		return nil
+	}
+	resChan := make(chan ArchiveResultChan, 10)
+	stopped := saveCaptures(d.Companies{URL: "a.com"}, [][]capture{captures}, dir, "newest", "yearly", 0, 0, resChan, save)
+	close(resChan)
+
+	want := []string{"2019 http://a.com/", "2019 http://a.com/about", "2019 http://a.com/team/ceo", "2020 http://a.com/"}
+	if !stopped || !reflect.DeepEqual(tried, want) {
+		t.Fatalf("stopped %v, tried %v", stopped, tried)
+	}
+	results := []ArchiveResultChan{}
+	for r := range resChan {
+		results = append(results, r)
+	}
+	if len(results) != 3 || results[0].Error == nil || results[1].Progress != 1 || results[1].Total != 2 ||
+		!errors.Is(results[2].Error, errQuotaExceeded) {
+		t.Fatalf("results = %+v", results)
+	}
+
+	// Amount of tried captures is limited
+	tried = []string{}
+	saveCaptures(d.Companies{URL: "a.com"}, [][]capture{captures[:4]}, dir, "newest", "yearly", 2, 0, make(chan ArchiveResultChan, 10), save)
+	if len(tried) != 2 {
+		t.Fatalf("tried %v", tried)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2019")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	d "./db"
+	"./warc"
+)
+
+// IngestResultChan ... result of work of `IngestWARC` function
+type IngestResultChan struct {
+	File    string
+	Records int
+	Saved   int
+	Warning error
+	Error   error
+	Done    bool
+}
+
+// IngestConfig ... Holds configuration parameters for ingestion of local WARC files
+type IngestConfig struct {
+	ResChanel  chan IngestResultChan
+	Path       string
+	Companies  map[string]d.Companies
+	Extensions []string
+	Store      *DocumentStore
+}
+
+// companyDomain ... Returns canonical domain of company URL, see `NormalizeDomain`
+func companyDomain(companyURL string) string {
+	domain, err := d.NormalizeDomain(companyURL)
+	if err != nil {
+		return strings.TrimPrefix(strings.ToLower(companyURL), "www.")
+	}
+	return domain
+}
+
+// companiesByDomain ... Makes lookup table from domain to company
+func companiesByDomain(companies []d.Companies) map[string]d.Companies {
+	domains := map[string]d.Companies{}
+	for _, c := range companies {
+		for _, site := range c.Sites() {
+			domains[companyDomain(site)] = c
+		}
+	}
+	return domains
+}
+
+// matchCompany ... Finds company which owns host of the URL. Subdomains belong to company of parent domain
+func matchCompany(targetURL string, domains map[string]d.Companies) (d.Companies, bool) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return d.Companies{}, false
+	}
+	host := companyDomain(u.Hostname())
+	for host != "" {
+		if c, found := domains[host]; found {
+			return c, true
+		}
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return d.Companies{}, false
+}
+
+// warcFiles ... Expands glob patterns into list of WARC files
+func warcFiles(patterns []string) ([]string, error) {
+	files := []string{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("[warcFiles] bad pattern %v: %v", pattern, err)
+		}
+		for _, m := range matches {
+			if strings.HasSuffix(m, ".warc") || strings.HasSuffix(m, ".warc.gz") {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// recordPayload ... Returns headers and payload of successful response or of resource, e.g. content replayed
+// by web archive
+func recordPayload(record *warc.Record) (http.Header, []byte, bool) {
+	if record.Type() == "resource" {
+		return http.Header{"Content-Type": {record.Header.Get("Content-Type")}}, record.Content, true
+	}
+	resp, payload, err := record.HTTPResponse()
+	if err != nil || resp.StatusCode != 200 {
+		return nil, nil, false
+	}
+	return resp.Header, payload, true
+}
+
+// IngestWARC ... Streams local WARC file and saves responses which belong to known companies
+func IngestWARC(filename string, config IngestConfig) {
+	result := IngestResultChan{File: filename}
+	defer func() {
+		result.Done = true
+		config.ResChanel <- result
+	}()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		result.Error = fmt.Errorf("[IngestWARC] error: %v", err)
+		return
+	}
+	defer f.Close()
+
+	reader, err := warc.NewReader(f)
+	if err != nil {
+		result.Error = fmt.Errorf("[IngestWARC] error: %v", err)
+		return
+	}
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			result.Error = fmt.Errorf("[IngestWARC] record %v: %v", result.Records, err)
+			return
+		}
+		result.Records++
+
+		if record.Type() != "response" && record.Type() != "resource" {
+			continue
+		}
+		c, found := matchCompany(record.TargetURI(), config.Companies)
+		if !found {
+			continue
+		}
+		header, payload, ok := recordPayload(record)
+		if !ok {
+			continue
+		}
+
+		saveFolder := path.Join(config.Path, c.Class, url.PathEscape(c.URL))
+		if err = CreateDir(saveFolder); err != nil {
+			config.ResChanel <- IngestResultChan{File: filename, Warning: err}
+			continue
+		}
+		capturedAt, _ := record.Date()
+		doc := d.Documents{CompanyID: c.ID, Crawler: "local", URL: record.TargetURI(), Snapshot: path.Base(filename),
+			CapturedAt: capturedAt}
+		saved, err := saveArchived(doc, header, payload, saveFolder, config.Extensions, config.Store)
+		if errors.Is(err, errQuotaExceeded) && config.Store.Quota.Full() {
+			result.Error = err
+			return
+		} else if errors.Is(err, errNotAllowed) {
+			continue
+		} else if err != nil {
+			config.ResChanel <- IngestResultChan{File: filename, Warning: err}
+			continue
+		}
+		if saved != "" {
+			result.Saved++
+		}
+	}
+}
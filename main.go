@@ -2,21 +2,27 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/url"
+	"os"
 	"path"
 	"sync"
 	"time"
 
-	cc "github.com/karust/gocommoncrawl"
-
+	"./cdx"
 	d "./db"
+	"./storage"
 	"github.com/BurntSushi/toml"
 )
 
 // Miner ... Holds reference of database and does grouping of methods
 type Miner struct {
-	db              d.Database
+	db              d.Repository
 	industryFolders []string
+	archive         *Archiver
+	store           *DocumentStore
+	dead            map[string]bool
+	deadSites       string
 }
 
 // CommonCrawl ... Crawler which uses Common Crawl web archive to get HTML pages and other data
@@ -26,14 +32,86 @@ func (m Miner) CommonCrawl(config commonConfig, wg *sync.WaitGroup) {
 	// Create directories in which data from sites will be saved
 	err := CreateDirs(config.Path, m.industryFolders)
 	if err != nil {
-		fmt.Printf("[CollyCrawl] Fatal error occured: %v\n", err)
+		fmt.Printf("[CommonCrawl] Fatal error occured: %v\n", err)
+		return
+	}
+
+	// Get snapshots of Web Archive which will be queried
+	snapshots, err := commonSnapshots(config)
+	if err != nil {
+		fmt.Printf("[CommonCrawl] Fatal error occured: %v\n", err)
 		return
 	}
 
-	// Initialize variables
 	logger := logToFile(config.Path + "/common_log.txt")
-	resChan := make(chan cc.Result)
-	companies := m.db.GetCommon()
+	logger.Printf("Snapshots: %v\n", snapshots)
+	client := cdx.NewClient(config.IndexURL, config.DataURL, time.Second*time.Duration(config.Timeout))
+	loop := archiveLoop{Name: "Common", Crawler: d.CrawlerCommon, Path: config.Path, Workers: config.Workers, Debug: config.Debug, Logger: logger,
+		Interval: time.Second * time.Duration(config.SearchInterval)}
+
+	fetch := func(c d.Companies, saveFolder string, resChan chan ArchiveResultChan) {
+		commonConfig := CommonConfig{ResChanel: resChan, Client: client, Snapshots: snapshots, Keep: config.Keep,
+			Period: config.Period, From: config.From, To: config.To,
+			Filters: commonFilters(config), Extensions: config.Extensions, MaxAmount: config.MaxAmount,
+			Wait:    time.Millisecond * time.Duration(config.WaitTime),
+			Archive: m.archive, Store: m.store, Industry: c.Class}
+		FetchSnapshots(c, saveFolder, commonConfig)
+	}
+	m.archiveCrawl(loop, m.db.GetCommon(), fetch, m.db.CommonFinished)
+}
+
+// WaybackCrawl ... Crawler which uses Wayback Machine of Internet Archive to get HTML pages and documents
+func (m Miner) WaybackCrawl(config waybackConfig, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Create directories in which data from sites will be saved
+	err := CreateDirs(config.Path, m.industryFolders)
+	if err != nil {
+		fmt.Printf("[WaybackCrawl] Fatal error occured: %v\n", err)
+		return
+	}
+
+	logger := logToFile(config.Path + "/wayback_log.txt")
+	client := cdx.NewWaybackClient(config.CDXURL, config.WebURL, time.Second*time.Duration(config.Timeout))
+	query := waybackQuery(config)
+	loop := archiveLoop{Name: "Wayback", Crawler: d.CrawlerWayback, Path: config.Path, Workers: config.Workers, Debug: config.Debug, Logger: logger,
+		Interval: time.Second * time.Duration(config.SearchInterval)}
+
+	fetch := func(c d.Companies, saveFolder string, resChan chan ArchiveResultChan) {
+		waybackConfig := WaybackConfig{ResChanel: resChan, Client: client, Query: query, Keep: config.Keep,
+			Period: config.Period, Extensions: config.Extensions,
+			MaxAmount: config.MaxAmount, Wait: time.Millisecond * time.Duration(config.WaitTime),
+			Archive: m.archive, Store: m.store, Industry: c.Class}
+		FetchWayback(c, saveFolder, waybackConfig)
+	}
+	m.archiveCrawl(loop, m.db.GetWayback(), fetch, m.db.WaybackFinished)
+}
+
+// archiveLoop ... Settings of loop which crawls companies from web archive
+type archiveLoop struct {
+	Name     string
+	Crawler  string
+	Path     string
+	Workers  int
+	Interval time.Duration
+	Debug    bool
+	Logger   *log.Logger
+}
+
+// archiveCrawl ... Runs `fetch` for companies in order of class balance by `Workers` goroutines. Archive index is
+// queried not more often than `Interval`. Companies which are fetched completely are marked by `finished`,
+// ones stopped by quota or failed to be searched in index are left for the next run
+func (m Miner) archiveCrawl(loop archiveLoop, companies []d.Companies,
+	fetch func(c d.Companies, saveFolder string, resChan chan ArchiveResultChan), finished func(url string)) {
+	companies = m.store.Balance.Order(m.crawlable(companies, true))
+	if len(companies) == 0 {
+		return
+	}
+
+	// Initialize variables
+	logger := loop.Logger
+	resChan := make(chan ArchiveResultChan)
+	var mutex sync.Mutex
 	workers := 0
 	var innerWg sync.WaitGroup
 	innerWg.Add(len(companies) + 1)
@@ -43,22 +121,40 @@ func (m Miner) CommonCrawl(config commonConfig, wg *sync.WaitGroup) {
 		done := 0
 		for r := range resChan {
 			if r.Error != nil {
-				logger.Printf("[CommonCrawl] Error occured: %v\n", r.Error)
+				logger.Printf("[%vCrawl] Error occured: %v\n", loop.Name, r.Error)
+			} else if r.Done && r.Skipped {
+				logger.Printf("%v skipped, claimed by another miner: %v\n", loop.Name, r.URL)
+			} else if r.Done && r.Stopped {
+				m.db.Release(loop.Crawler, r.URL)
+				logger.Printf("%v stopped by quota: %v\n", loop.Name, r.URL)
+			} else if r.Done && r.Failed {
+				m.db.Release(loop.Crawler, r.URL)
+				logger.Printf("%v failed, index is not available: %v\n", loop.Name, r.URL)
 			} else if r.Done {
-				m.db.CommonFinished(r.URL)
-				logger.Printf("Common done: %v\n", r.URL)
+				finished(r.URL)
+				logger.Printf("%v done: %v\n", loop.Name, r.URL)
+			}
+			if r.Done {
 				done++
+				mutex.Lock()
 				workers--
+				mutex.Unlock()
 				innerWg.Done()
 			}
 
 			// Debug output
-			if config.Debug && r.Error != nil {
+			if loop.Debug && r.Error != nil {
 				fmt.Printf("Error occured: %v\n", r.Error)
-			} else if config.Debug && r.Progress > 0 {
-				fmt.Printf("Progress %v: %v/%v\n", r.URL, r.Progress, r.Total)
-			} else if config.Debug && r.Done {
-				fmt.Printf("Commo done: %v\n", r.URL)
+			} else if loop.Debug && r.Progress > 0 {
+				fmt.Printf("Progress %v: %v/%v, quota left: %v\n", r.URL, r.Progress, r.Total, m.store.Quota.Left(r.URL))
+			} else if loop.Debug && r.Done && r.Skipped {
+				fmt.Printf("%v skipped, claimed by another miner: %v\n", loop.Name, r.URL)
+			} else if loop.Debug && r.Done && r.Stopped {
+				fmt.Printf("%v stopped by quota: %v\n", loop.Name, r.URL)
+			} else if loop.Debug && r.Done && r.Failed {
+				fmt.Printf("%v failed, index is not available: %v\n", loop.Name, r.URL)
+			} else if loop.Debug && r.Done {
+				fmt.Printf("%v done: %v\n", loop.Name, r.URL)
 			}
 
 			// If amount of `Dones` equal to amount of companies, then exit loop
@@ -69,28 +165,39 @@ func (m Miner) CommonCrawl(config commonConfig, wg *sync.WaitGroup) {
 		innerWg.Done()
 	}()
 
+	busy := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return workers >= loop.Workers && loop.Workers > 0
+	}
 	for _, c := range companies {
-		for workers >= config.Workers {
+		for busy() {
 			time.Sleep(time.Second * 1)
 		}
 
-		saveFolder := path.Join(config.Path, getCompanyIndustry(c), url.PathEscape(c.URL))
-
-		// Do not overload Index API server
-		waitTime := time.Second * time.Duration(config.SearchInterval)
-		start := time.Now()
-
-		// Make config for parser
-		commonConfig := cc.Config{ResultChan: resChan, Timeout: config.Timeout, CrawlDB: config.CrawlDB,
-			WaitMS: config.WaitTime, Extensions: config.Extensions, MaxAmount: config.MaxAmount}
+		saveFolder := path.Join(loop.Path, c.Class, url.PathEscape(c.URL))
+		err := CreateDir(saveFolder)
+		if err != nil && loop.Debug {
+			fmt.Printf("[%vCrawl] error: %v\n", loop.Name, err)
+		}
 
-		go cc.FetchURLData(c.URL, saveFolder, commonConfig)
+		// Company crawled by another miner sharing database is skipped at once
+		mutex.Lock()
 		workers++
+		mutex.Unlock()
+		if !m.db.Claim(loop.Crawler, c.URL) {
+			resChan <- ArchiveResultChan{URL: c.URL, Done: true, Skipped: true}
+			continue
+		}
 
-		// Wait time before proceed cycle
+		// Do not overload archive index server
+		start := time.Now()
+		go fetch(c, saveFolder, resChan)
+
+		// Wait time before proceed cycle, company which can't save more documents is skipped at once
 		elapsed := time.Since(start)
-		if elapsed < waitTime {
-			time.Sleep(waitTime - elapsed)
+		if elapsed < loop.Interval && m.store.Check(c.ID) == nil {
+			time.Sleep(loop.Interval - elapsed)
 		}
 	}
 	innerWg.Wait()
@@ -110,7 +217,9 @@ func (m Miner) GoogleCrawl(config googleConfig, wg *sync.WaitGroup) {
 	// Initialize variables
 	logger := logToFile(config.Path + "/google_log.txt")
 	resChan := make(chan GoogleResultChan)
-	companies := m.db.GetGoogle()
+	companies := m.store.Balance.Order(m.crawlable(m.db.GetGoogle(), false))
+	downloader := NewDownloader(time.Second*time.Duration(config.ConnectTimeout), time.Second*time.Duration(config.ReadTimeout),
+		config.Retries, int64(config.MaxFileSize)*1024*1024)
 	workers := 0
 	var innerWg sync.WaitGroup
 	innerWg.Add(len(companies) + 1)
@@ -120,10 +229,22 @@ func (m Miner) GoogleCrawl(config googleConfig, wg *sync.WaitGroup) {
 		done := 0
 		for r := range resChan {
 			if r.Error != nil {
+				m.db.Release(d.CrawlerGoogle, r.URL)
 				logger.Printf("Error occured [%v]: %v\n", r.URL, r.Error)
 				done++
 				workers--
 				innerWg.Done()
+			} else if r.Done && r.Skipped {
+				logger.Printf("Google skipped, claimed by another miner: %v\n", r.URL)
+				done++
+				workers--
+				innerWg.Done()
+			} else if r.Done && r.Stopped {
+				m.db.Release(d.CrawlerGoogle, r.URL)
+				logger.Printf("Google stopped by quota: %v\n", r.URL)
+				done++
+				workers--
+				innerWg.Done()
 			} else if r.Done {
 				m.db.GoogleFinished(r.URL)
 				logger.Printf("Google done: %v\n", r.URL)
@@ -132,13 +253,19 @@ func (m Miner) GoogleCrawl(config googleConfig, wg *sync.WaitGroup) {
 				innerWg.Done()
 			} else if r.Warning != nil {
 				logger.Printf("Warning [%v]: %v\n", r.URL, r.Warning)
+			} else if r.File != "" {
+				logger.Printf("Downloaded [%v]: %v sha256:%v\n", r.URL, r.File, r.Checksum)
 			}
 
 			// Debug output
 			if config.Debug && r.Error != nil {
 				fmt.Printf("Error occured [%v]: %v\n", r.URL, r.Error)
 			} else if config.Debug && r.Progress > 0 {
-				fmt.Printf("Progress %v: %v/%v\n", r.URL, r.Progress, r.Total)
+				fmt.Printf("Progress %v: %v/%v, quota left: %v\n", r.URL, r.Progress, r.Total, m.store.Quota.Left(r.URL))
+			} else if config.Debug && r.Done && r.Skipped {
+				fmt.Printf("Google skipped, claimed by another miner: %v\n", r.URL)
+			} else if config.Debug && r.Done && r.Stopped {
+				fmt.Printf("Google stopped by quota: %v\n", r.URL)
 			} else if config.Debug && r.Done {
 				fmt.Printf("Google done: %v\n", r.URL)
 			} else if config.Debug && r.Warning != nil {
@@ -157,23 +284,39 @@ func (m Miner) GoogleCrawl(config googleConfig, wg *sync.WaitGroup) {
 		for workers >= config.Workers {
 			time.Sleep(time.Second * 1)
 		}
+		if !m.db.Claim(d.CrawlerGoogle, c.URL) {
+			workers++
+			resChan <- GoogleResultChan{URL: c.URL, Done: true, Skipped: true}
+			continue
+		}
 
-		saveFolder := path.Join(config.Path, getCompanyIndustry(c), url.PathEscape(c.URL))
+		saveFolder := path.Join(config.Path, c.Class, url.PathEscape(c.URL))
 		err := CreateDir(saveFolder)
 		if err != nil && config.Debug {
 			fmt.Println("[GoogleCrawl] error: ", err)
 		}
+		// Files are downloaded locally first and then moved into storage
+		tempFolder := path.Join(os.TempDir(), "business_data_miner", "google", url.PathEscape(c.URL))
+		if err = os.MkdirAll(tempFolder, 0755); err != nil && config.Debug {
+			fmt.Println("[GoogleCrawl] error: ", err)
+		}
 
 		// Google search queries should not be too ofter, therefore launch goroutine with intervals
 		waitTime := time.Second * time.Duration(config.SearchInterval)
 		start := time.Now()
 
-		go FetchURLFiles(c.URL, config.Extension, saveFolder, config.MaxFileSize, resChan)
+		// Make configuration for search and downloads
+		googleConfig := GoogleConfig{ResChanel: resChan, Extension: config.Extension, Downloader: downloader,
+			TempDir: tempFolder, MaxResults: config.MaxResults, PageInterval: time.Second * time.Duration(config.PageInterval),
+			DB: m.db, CacheTTL: time.Hour * time.Duration(config.CacheTTL),
+			Archive: m.archive, Store: m.store, Industry: c.Class, CompanyID: c.ID, Domains: c.Domains}
+
+		go FetchURLFiles(c.URL, saveFolder, googleConfig)
 		workers++
 
-		// Wait time before next cycle
+		// Wait time before next cycle, company which can't save more documents is skipped at once
 		elapsed := time.Since(start)
-		if elapsed < waitTime {
+		if elapsed < waitTime && m.store.Check(c.ID) == nil {
 			time.Sleep(waitTime - elapsed)
 		}
 	}
@@ -194,7 +337,7 @@ func (m Miner) CollyCrawl(config collyConfig, wg *sync.WaitGroup) {
 	// Initialize variables
 	logger := logToFile(config.Path + "/colly_log.txt")
 	resChan := make(chan CollyResultChan)
-	companies := m.db.GetColly()
+	companies := m.store.Balance.Order(m.crawlable(m.db.GetColly(), false))
 	workers := 0
 	var innerWg sync.WaitGroup
 	innerWg.Add(len(companies) + 1)
@@ -205,6 +348,17 @@ func (m Miner) CollyCrawl(config collyConfig, wg *sync.WaitGroup) {
 		for r := range resChan {
 			if r.Error != nil {
 				logger.Printf("[CollyCrawl] Error occured: %v\n", r.Error)
+			} else if r.Done && r.Skipped {
+				logger.Printf("Colly skipped, claimed by another miner: %v\n", r.URL)
+				done++
+				workers--
+				innerWg.Done()
+			} else if r.Done && r.Stopped {
+				m.db.Release(d.CrawlerColly, r.URL)
+				logger.Printf("Colly stopped by quota: %v\n", r.URL)
+				done++
+				workers--
+				innerWg.Done()
 			} else if r.Done && r.Loaded > 0 {
 				// Save state in database
 				m.db.CollyFinished(r.URL)
@@ -213,6 +367,7 @@ func (m Miner) CollyCrawl(config collyConfig, wg *sync.WaitGroup) {
 				workers--
 				innerWg.Done()
 			} else if r.Done && r.Loaded == 0 {
+				m.db.Release(d.CrawlerColly, r.URL)
 				logger.Printf("Colly failed: %v\n", r.URL)
 				done++
 				workers--
@@ -222,8 +377,12 @@ func (m Miner) CollyCrawl(config collyConfig, wg *sync.WaitGroup) {
 			// Debug output
 			if config.Debug && r.Error != nil {
 				fmt.Printf("[CollyCrawl] Error occured: %v\n", r.Error)
+			} else if config.Debug && r.Done && r.Skipped {
+				fmt.Printf("Colly skipped, claimed by another miner: %v\n", r.URL)
+			} else if config.Debug && r.Done && r.Stopped {
+				fmt.Printf("Colly stopped by quota: %v\n", r.URL)
 			} else if config.Debug && r.Done && r.Loaded > 0 {
-				fmt.Printf("Colly done: %v\n", r.URL)
+				fmt.Printf("Colly done: %v, quota left: %v\n", r.URL, m.store.Quota.Left(r.URL))
 			} else if config.Debug && r.Done && r.Loaded == 0 {
 				fmt.Printf("Colly failed: %v\n", r.URL)
 			}
@@ -241,15 +400,23 @@ func (m Miner) CollyCrawl(config collyConfig, wg *sync.WaitGroup) {
 		for workers >= config.Workers {
 			time.Sleep(time.Second * 1)
 		}
-		saveFolder := path.Join(config.Path, getCompanyIndustry(c), url.PathEscape(c.URL))
+		if !m.db.Claim(d.CrawlerColly, c.URL) {
+			workers++
+			resChan <- CollyResultChan{URL: c.URL, Done: true, Skipped: true}
+			continue
+		}
+		saveFolder := path.Join(config.Path, c.Class, url.PathEscape(c.URL))
 		err := CreateDir(saveFolder)
 		if err != nil {
 			panic(err)
 		}
 
 		// Make configuration for crawler
+		starts := m.startURLs(c)
 		collyConfig := CollyConfig{ResChanel: resChan, MaxAmount: config.MaxAmount, Extensions: config.Extensions,
-			MaxFileSize: config.MaxFileSize, MaxHTMLLoad: config.MaxHTMLLoad, WorkMinutes: config.WorkMinutes, RandomizeName: config.RandomName}
+			MaxFileSize: config.MaxFileSize, MaxHTMLLoad: config.MaxHTMLLoad, WorkMinutes: config.WorkMinutes,
+			Archive: m.archive, Store: m.store, Industry: c.Class, CompanyID: c.ID, Domains: c.Domains,
+			StartURLs: starts, Fallbacks: fallbackURLs(c, starts)}
 
 		go CrawlSite(c.URL, saveFolder, collyConfig)
 		workers++
@@ -258,6 +425,114 @@ func (m Miner) CollyCrawl(config collyConfig, wg *sync.WaitGroup) {
 	innerWg.Wait()
 }
 
+// LocalIngest ... Mines local WARC files without network access. Responses are matched to companies by domain
+func (m Miner) LocalIngest(config ingestConfig, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Create directories in which data from sites will be saved
+	err := CreateDirs(config.Path, m.industryFolders)
+	if err != nil {
+		fmt.Printf("[LocalIngest] Fatal error occured: %v\n", err)
+		return
+	}
+	files, err := warcFiles(config.Inputs)
+	if err != nil {
+		fmt.Printf("[LocalIngest] Fatal error occured: %v\n", err)
+		return
+	} else if len(files) == 0 {
+		fmt.Println("[LocalIngest] No WARC files found")
+		return
+	}
+
+	// Initialize variables
+	logger := logToFile(config.Path + "/ingest_log.txt")
+	resChan := make(chan IngestResultChan)
+	domains := companiesByDomain(m.db.GetCompanies())
+	workers := 0
+	var innerWg sync.WaitGroup
+	innerWg.Add(len(files) + 1)
+
+	// Track progress from goroutines via channel
+	go func() {
+		done := 0
+		for r := range resChan {
+			if r.Warning != nil {
+				logger.Printf("Warning [%v]: %v\n", r.File, r.Warning)
+			} else if r.Done {
+				if r.Error != nil {
+					logger.Printf("Error occured [%v]: %v\n", r.File, r.Error)
+				}
+				logger.Printf("Ingest done: %v, records: %v, saved: %v\n", r.File, r.Records, r.Saved)
+				done++
+				workers--
+				innerWg.Done()
+			}
+
+			// Debug output
+			if config.Debug && r.Warning != nil {
+				fmt.Printf("Warning [%v]: %v\n", r.File, r.Warning)
+			} else if config.Debug && r.Done {
+				fmt.Printf("Ingest done: %v, records: %v, saved: %v\n", r.File, r.Records, r.Saved)
+			}
+
+			// If amount of `Dones` equal to amount of files, then exit loop
+			if done == len(files) {
+				break
+			}
+		}
+		innerWg.Done()
+	}()
+
+	for _, f := range files {
+		for workers >= config.Workers {
+			time.Sleep(time.Second * 1)
+		}
+
+		ingestConfig := IngestConfig{ResChanel: resChan, Path: config.Path, Companies: domains,
+			Extensions: config.Extensions, Store: m.store}
+
+		go IngestWARC(f, ingestConfig)
+		workers++
+	}
+	innerWg.Wait()
+}
+
+// writablePaths ... Returns local folders which miner writes into with given configuration
+func writablePaths(config Config) []string {
+	crawlers := []struct {
+		use  bool
+		path string
+	}{{config.Ingest.Use, config.Ingest.Path}, {config.Common.Use, config.Common.Path},
+		{config.Wayback.Use, config.Wayback.Path}, {config.Google.Use, config.Google.Path},
+		{config.Colly.Use, config.Colly.Path}}
+	local := config.Storage.Backend == "" || config.Storage.Backend == "local"
+
+	paths := []string{}
+	for _, c := range crawlers {
+		if !c.use {
+			continue
+		}
+		// Logs are kept locally with any storage backend
+		paths = append(paths, c.path)
+		if local && config.Storage.Root != "" {
+			paths = append(paths, path.Join(config.Storage.Root, c.path))
+		}
+	}
+	if local && config.Storage.ContentAddressed {
+		paths = append(paths, path.Join(config.Storage.Root, config.Storage.Blobs))
+	}
+	if local && config.Export.Use {
+		paths = append(paths, path.Join(config.Storage.Root, config.Export.Path))
+	}
+	if config.WARC.Use {
+		paths = append(paths, config.WARC.Path)
+	}
+	if config.Google.Use {
+		paths = append(paths, os.TempDir())
+	}
+	return paths
+}
+
 func main() {
 	// Try to load configuration file, if error then meaningless to proceed
 	var config Config
@@ -266,23 +541,133 @@ func main() {
 		panic(err)
 	}
 
+	// Report all unwritable folders before crawling begins
+	writable := true
+	for _, p := range writablePaths(config) {
+		if err := CheckWritable(p); err != nil {
+			fmt.Printf("Path is not writable %v: %v\n", p, err)
+			writable = false
+		}
+	}
+	if !writable {
+		os.Exit(1)
+	}
+
+	// Classes can be taken at any level of taxonomy
+	for _, level := range []string{config.General.ClassLevel, config.Export.ClassLevel} {
+		if level != "" && !d.IsLevel(level) {
+			fmt.Printf("Unknown class level %v, one of %v is expected\n", level, d.Levels)
+			os.Exit(1)
+		}
+	}
+
+	// Historical mode of archive crawlers splits captures by known periods only
+	for _, period := range []string{config.Common.Period, config.Wayback.Period} {
+		if err := validPeriod(period); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	switch config.Resolver.DeadSites {
+	case "", "archive", "skip", "crawl":
+	default:
+		fmt.Printf("Unknown dead_sites %v, one of archive, skip or crawl is expected\n", config.Resolver.DeadSites)
+		os.Exit(1)
+	}
+
 	// Initialize miner and database
 	miner := Miner{}
-	miner.db = d.Database{}
-	miner.db.OpenInitialize(config.General.Database)
-	miner.db.PrintInfo()
-	defer miner.db.Close()
+	database := &d.Database{}
+	// Shared PostgreSQL database is used instead of local SQLite one if it is configured
+	dialect, source := d.DialectSQLite, config.General.Database
+	if config.General.DSN != "" {
+		dialect, source = d.DialectPostgres, config.General.DSN
+	}
+	if config.General.Lease > 0 {
+		database.Lease = time.Minute * time.Duration(config.General.Lease)
+	}
+	database.OpenInitialize(dialect, source)
+	if config.General.ClassLevel != "" {
+		database.ClassLevel = config.General.ClassLevel
+	}
+	// Several taxonomies can be kept in database, their definitions are imported from files
+	if err := ImportTaxonomies(database, config.Taxonomy.Files); err != nil {
+		fmt.Println("Taxonomy import error: ", err)
+		os.Exit(1)
+	}
+	if err := database.UseTaxonomy(config.Taxonomy.Name); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := database.RefreshCounts(); err != nil {
+		fmt.Println("Counts refresh error: ", err)
+	}
+	database.PrintInfo()
+	defer database.Close()
+	miner.db = database
+
+	// Collected files are saved through storage backend, optionally once by their content
+	backend, err := NewStorage(config.Storage)
+	if err != nil {
+		panic(err)
+	}
+	miner.store = NewDocumentStore(config.Storage, backend, miner.db)
+
+	// Limit storage used by each company, class and whole dataset
+	quota, err := NewQuota(config.Quota, miner.db.GetCompanies(), miner.db.DocumentTotals())
+	if err != nil {
+		panic(err)
+	}
+	miner.store.Quota = quota
+	fmt.Println("Storage quota left: ", quota.Left(""))
+
+	// Prefer classes which have less data than their targets
+	balance, err := NewBalance(config.Balance, miner.db.GetCompanies(), miner.db.DocumentTotals())
+	if err != nil {
+		panic(err)
+	}
+	miner.store.Balance = balance
+	balance.Print()
+
+	// Optionally keep everything fetched in WARC files, completed files are moved into remote storage
+	var remote storage.Storage
+	if config.Storage.Backend == "s3" {
+		remote = backend
+	}
+	miner.archive = NewArchiver(config.WARC, remote)
+	defer miner.archive.Close()
+
+	// Check liveness of sites and find working scheme and host of them, so crawlers start from URLs which respond
+	if config.Resolver.Use {
+		miner.ResolveSites(config.Resolver)
+	}
+	// Companies whose sites are dead are crawled according to policy
+	miner.dead = deadStatuses(config.Resolver)
+	miner.deadSites = config.Resolver.DeadSites
 
 	// Get insustry folders in which data will be saved in categorized way
 	miner.industryFolders = miner.db.GetIndustriesFolders()
 
 	var wg sync.WaitGroup
+	// 0. Mine local WARC files which are already on disk
+	if config.Ingest.Use {
+		wg.Add(1)
+		go miner.LocalIngest(config.Ingest, &wg)
+	}
+
 	// 1. Use CommonCrawl to retrive indexed HTML pages of given site
 	if config.Common.Use {
 		wg.Add(1)
 		go miner.CommonCrawl(config.Common, &wg)
 	}
 
+	// 1.1. Use Wayback Machine as another web archive
+	if config.Wayback.Use {
+		wg.Add(1)
+		go miner.WaybackCrawl(config.Wayback, &wg)
+	}
+
 	// 2. Use Google search with to find cached files
 	if config.Google.Use {
 		wg.Add(1)
@@ -295,4 +680,21 @@ func main() {
 		go miner.CollyCrawl(config.Colly, &wg)
 	}
 	wg.Wait()
+	database.PrintDedup()
+	fmt.Println("Storage quota left: ", quota.Left(""))
+	balance.Print()
+
+	// 4. Mark near-duplicate pages, so they can be dropped from dataset
+	if config.NearDup.Use {
+		if err := miner.NearDuplicates(config.NearDup); err != nil {
+			fmt.Println("Near-duplicates error: ", err)
+		}
+	}
+
+	// 5. Make dataset from collected documents
+	if config.Export.Use {
+		if err := miner.Export(config.Export); err != nil {
+			fmt.Println("Export error: ", err)
+		}
+	}
 }
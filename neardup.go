@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	d "./db"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Amount of words in shingle used for SimHash
+const shingleSize = 3
+
+// extractText ... Returns visible text of HTML page or plain text document. Other formats give empty text
+func extractText(content []byte) string {
+	switch ExtensionByContent(content) {
+	case ".html", ".xml":
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+		if err != nil {
+			return ""
+		}
+		doc.Find("script, style, noscript").Remove()
+		return doc.Text()
+	case ".txt":
+		return string(content)
+	}
+	return ""
+}
+
+// simHash ... Calculates 64-bit SimHash of text from its word shingles
+func simHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words) || i == 0; i++ {
+		end := i + shingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<uint(b)) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+
+	var hash uint64
+	for b := 0; b < 64; b++ {
+		if weights[b] > 0 {
+			hash |= 1 << uint(b)
+		}
+	}
+	return hash
+}
+
+// nearDuplicates ... Groups documents whose SimHashes differ in not more than `maxDistance` bits.
+// Returns map from document ID to ID of the first document of its group
+func nearDuplicates(hashes map[int]uint64, ids []int, maxDistance int) map[int]int {
+	// If hashes differ in `maxDistance` bits, then at least one of `maxDistance+1` bands is equal in both
+	bands := maxDistance + 1
+	if bands > 64 {
+		bands = 64
+	}
+	parent := map[int]int{}
+	var find func(id int) int
+	find = func(id int) int {
+		if p, found := parent[id]; found && p != id {
+			parent[id] = find(p)
+			return parent[id]
+		}
+		return id
+	}
+
+	for band := 0; band < bands; band++ {
+		from, to := band*64/bands, (band+1)*64/bands
+		mask := (^uint64(0) >> uint(64-(to-from))) << uint(from)
+		buckets := map[uint64][]int{}
+		for _, id := range ids {
+			key := hashes[id] & mask
+			for _, other := range buckets[key] {
+				if bits.OnesCount64(hashes[id]^hashes[other]) > maxDistance {
+					continue
+				}
+				// Keep the earliest document as root of the group
+				a, b := find(id), find(other)
+				if a > b {
+					a, b = b, a
+				}
+				if a != b {
+					parent[b] = a
+				}
+			}
+			buckets[key] = append(buckets[key], id)
+		}
+	}
+
+	duplicates := map[int]int{}
+	for _, id := range ids {
+		if root := find(id); root != id {
+			duplicates[id] = root
+		}
+	}
+	return duplicates
+}
+
+// NearDuplicates ... Finds near-duplicate documents by text similarity and marks them in manifest.
+// Documents are compared within each company or across the whole corpus depending on `scope`
+func (m Miner) NearDuplicates(config nearDupConfig) error {
+	if config.Threshold <= 0 || config.Threshold > 1 {
+		return fmt.Errorf("[NearDuplicates] threshold should be in (0, 1]: %v", config.Threshold)
+	}
+	maxDistance := int((1 - config.Threshold) * 64)
+
+	// Group documents with text by scope
+	hashes := map[int]uint64{}
+	groups := map[int][]int{}
+	for _, doc := range m.db.GetDocuments() {
+		content, err := m.store.Storage.Get(doc.Path)
+		if err != nil {
+			continue
+		}
+		text := extractText(content)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		hashes[doc.ID] = simHash(text)
+
+		scope := 0
+		if config.Scope != "corpus" {
+			scope = doc.CompanyID
+		}
+		groups[scope] = append(groups[scope], doc.ID)
+	}
+
+	if err := m.db.ClearDuplicates(); err != nil {
+		return fmt.Errorf("[NearDuplicates] error: %v", err)
+	}
+	total := 0
+	for _, ids := range groups {
+		for id, of := range nearDuplicates(hashes, ids, maxDistance) {
+			if err := m.db.MarkDuplicate(id, of); err != nil {
+				return fmt.Errorf("[NearDuplicates] error: %v", err)
+			}
+			total++
+		}
+	}
+	fmt.Println("Near-duplicate documents: ", total)
+	return nil
+}
+
+// isDuplicate ... Checks whether document is marked as near-duplicate of another one
+func isDuplicate(doc d.Documents) bool {
+	return doc.DuplicateOf != nil && *doc.DuplicateOf != 0
+}
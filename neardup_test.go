@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"reflect"
+	"strings"
+	"testing"
+
+	d "./db"
+	"./storage"
+)
+
+// words ... Returns text of `amount` different words with prefix
+func words(prefix string, amount int) []string {
+	text := []string{}
+	for i := 0; i < amount; i++ {
+		text = append(text, fmt.Sprintf("%v%d", prefix, i))
+	}
+	return text
+}
+
+func TestSimHash(t *testing.T) {
+	page := words("report", 300)
+	edited := append([]string{}, page...)
+	edited[150] = "changed"
+	// Threshold 0.9 of near-duplicates
+	maxDistance := 6
+
+	if distance := bits.OnesCount64(simHash(strings.Join(page, " ")) ^ simHash(strings.Join(edited, " "))); distance > maxDistance {
+		t.Errorf("near-identical pages differ in %v bits", distance)
+	}
+	if distance := bits.OnesCount64(simHash(strings.Join(page, " ")) ^ simHash(strings.Join(words("news", 300), " "))); distance <= maxDistance {
+		t.Errorf("unrelated pages differ in %v bits", distance)
+	}
+	// Case and punctuation are ignored
+	if simHash("Annual report, 2019!") != simHash("annual REPORT 2019") {
+		t.Error("hash depends on case or punctuation")
+	}
+	if simHash("") != 0 || simHash(" ... !") != 0 {
+		t.Error("empty text has hash")
+	}
+}
+
+func TestNearDuplicateGroups(t *testing.T) {
+	base := uint64(0xF0F0F0F0F0F0F0F0)
+	hashes := map[int]uint64{
+		1: base,
+		2: base ^ 0x7,                // 3 bits from 1
+		3: base ^ 0xF000000000000000, // 4 bits from 1
+		4: ^base,
+		5: base ^ 0x7 ^ 0x700, // 3 bits from 2, 6 from 1
+	}
+	ids := []int{1, 2, 3, 4, 5}
+	for _, test := range []struct {
+		maxDistance int
+		duplicates  map[int]int
+	}{
+		{0, map[int]int{}},
+		{3, map[int]int{2: 1, 5: 1}},
+		{4, map[int]int{2: 1, 3: 1, 5: 1}},
+		{64, map[int]int{2: 1, 3: 1, 4: 1, 5: 1}},
+	} {
+		if duplicates := nearDuplicates(hashes, ids, test.maxDistance); !reflect.DeepEqual(duplicates, test.duplicates) {
+			t.Errorf("distance %v: duplicates %v, want %v", test.maxDistance, duplicates, test.duplicates)
+		}
+	}
+}
+
+func TestExportDropsNearDuplicates(t *testing.T) {
+	memory := classifiedMemory()
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	m := Miner{db: memory, store: store}
+	page := words("report", 300)
+	edited := append([]string{}, page...)
+	edited[150] = "changed"
+	for _, doc := range []struct {
+		companyID int
+		name      string
+		text      []string
+	}{
+		{1, "colly/Banks/a.com/index.html", page},
+		{1, "colly/Banks/a.com/index-2.html", edited},
+		{1, "colly/Banks/a.com/news.html", words("news", 300)},
+		{2, "colly/Banks/b.com/index.html", page},
+		{1, "colly/Banks/a.com/empty.html", nil},
+	} {
+		content := []byte("<html><body><p>" + strings.Join(doc.text, " ") + "</p></body></html>")
+		if _, err := store.Save(d.Documents{CompanyID: doc.companyID, Crawler: "colly", URL: "http://" + doc.name}, content,
+			doc.name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Copy of page by another company is kept within company scope and dropped within corpus
+	for _, test := range []struct {
+		scope    string
+		exported []string
+	}{
+		{"company", []string{"index.html", "news.html", "index.html", "empty.html"}},
+		{"corpus", []string{"index.html", "news.html", "empty.html"}},
+	} {
+		if err := m.NearDuplicates(nearDupConfig{Threshold: 0.9, Scope: test.scope}); err != nil {
+			t.Fatal(err)
+		}
+		exported := []string{}
+		for _, r := range exportedRecords(t, m, exportConfig{Path: "dataset-" + test.scope, DropNearDuplicates: true}) {
+			exported = append(exported, r.File[strings.LastIndex(r.File, "/")+1:])
+		}
+		if !reflect.DeepEqual(exported, test.exported) {
+			t.Errorf("scope %v: exported %v, want %v", test.scope, exported, test.exported)
+		}
+	}
+	if err := m.NearDuplicates(nearDupConfig{Threshold: 1.5}); err == nil {
+		t.Error("threshold above 1 is accepted")
+	}
+}
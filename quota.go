@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	d "./db"
+)
+
+// errQuotaExceeded ... Returned when saving document would exceed one of storage budgets
+var errQuotaExceeded = errors.New("storage quota exceeded")
+
+// Quota ... Storage budgets for the whole dataset, each industry class and each company. Sizes of already
+// collected documents are counted too, so limits hold between runs. Nil quota means no limits
+type Quota struct {
+	Global  int64
+	Class   int64
+	Company int64
+
+	mutex       sync.Mutex
+	classes     map[int]string
+	ids         map[string]int
+	usedGlobal  int64
+	usedClass   map[string]int64
+	usedCompany map[int]int64
+}
+
+// parseSize ... Parses size like `500MB` or `2 GB` into bytes, number without unit is taken in megabytes
+func parseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	if size == "" {
+		return 0, nil
+	}
+	multiplier := int64(1024 * 1024)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("[parseSize] bad size: %v", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// formatSize ... Returns human readable size, negative size is shown as zero
+func formatSize(size int64) string {
+	if size < 0 {
+		size = 0
+	}
+	if size >= 1<<30 {
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
+
+// NewQuota ... Creates quota from configuration and totals of already collected documents of companies.
+// Returns nil if no budget is set
+func NewQuota(config quotaConfig, companies []d.Companies, totals map[int]d.DocumentTotal) (*Quota, error) {
+	q := &Quota{classes: map[int]string{}, ids: map[string]int{}, usedClass: map[string]int64{}, usedCompany: map[int]int64{}}
+	var err error
+	if q.Global, err = parseSize(config.Global); err != nil {
+		return nil, err
+	}
+	if q.Class, err = parseSize(config.Class); err != nil {
+		return nil, err
+	}
+	if q.Company, err = parseSize(config.Company); err != nil {
+		return nil, err
+	}
+	if q.Global == 0 && q.Class == 0 && q.Company == 0 {
+		return nil, nil
+	}
+
+	for _, c := range companies {
+		class := c.Class
+		q.classes[c.ID] = class
+		q.ids[c.URL] = c.ID
+		q.usedCompany[c.ID] += totals[c.ID].Bytes
+		q.usedClass[class] += totals[c.ID].Bytes
+	}
+	for _, total := range totals {
+		q.usedGlobal += total.Bytes
+	}
+	return q, nil
+}
+
+// exceeded ... Returns error for the first budget which can't hold `size` more bytes of company
+func (q *Quota) exceeded(companyID int, size int64) error {
+	class := q.classes[companyID]
+	switch {
+	case q.Global > 0 && q.usedGlobal+size > q.Global:
+		return fmt.Errorf("%w: global %v", errQuotaExceeded, formatSize(q.Global))
+	case q.Class > 0 && q.usedClass[class]+size > q.Class:
+		return fmt.Errorf("%w: class %v %v", errQuotaExceeded, class, formatSize(q.Class))
+	case q.Company > 0 && q.usedCompany[companyID]+size > q.Company:
+		return fmt.Errorf("%w: company %v", errQuotaExceeded, formatSize(q.Company))
+	}
+	return nil
+}
+
+// Check ... Returns error if any budget of company is already spent
+func (q *Quota) Check(companyID int) error {
+	if q == nil {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.exceeded(companyID, 1)
+}
+
+// Full ... Checks whether global budget is spent
+func (q *Quota) Full() bool {
+	if q == nil {
+		return false
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.Global > 0 && q.usedGlobal >= q.Global
+}
+
+// Reserve ... Takes `size` bytes from budgets of company, error is returned if some of them is not enough
+func (q *Quota) Reserve(companyID int, size int64) error {
+	if q == nil {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err := q.exceeded(companyID, size); err != nil {
+		return err
+	}
+	q.usedGlobal += size
+	q.usedClass[q.classes[companyID]] += size
+	q.usedCompany[companyID] += size
+	return nil
+}
+
+// Release ... Returns reserved bytes back, e.g. when file was not saved
+func (q *Quota) Release(companyID int, size int64) {
+	if q == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.usedGlobal -= size
+	q.usedClass[q.classes[companyID]] -= size
+	q.usedCompany[companyID] -= size
+}
+
+// Left ... Returns remaining budgets of company with given URL for status output. Empty URL gives global budget only
+func (q *Quota) Left(companyURL string) string {
+	if q == nil {
+		return "unlimited"
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	left := []string{}
+	if q.Global > 0 {
+		left = append(left, "global "+formatSize(q.Global-q.usedGlobal))
+	}
+	id, found := q.ids[companyURL]
+	if found && q.Class > 0 {
+		left = append(left, "class "+formatSize(q.Class-q.usedClass[q.classes[id]]))
+	}
+	if found && q.Company > 0 {
+		left = append(left, "company "+formatSize(q.Company-q.usedCompany[id]))
+	}
+	if len(left) == 0 {
+		return "unlimited"
+	}
+	return strings.Join(left, ", ")
+}
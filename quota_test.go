@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	d "./db"
+	"./storage"
+)
+
+func TestQuotaReserve(t *testing.T) {
+	memory := classifiedMemory()
+	memory.AddDocument(&d.Documents{CompanyID: 1, Crawler: "colly", Path: "colly/Banks/a.com/index.html", Size: 600})
+	quota, err := NewQuota(quotaConfig{Global: "2.5KB", Class: "2KB", Company: "1KB"}, memory.GetCompanies(), memory.DocumentTotals())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sizes of collected documents are counted
+	if err = quota.Reserve(1, 500); !errors.Is(err, errQuotaExceeded) || !strings.Contains(err.Error(), "company") {
+		t.Fatalf("Reserve over company budget = %v", err)
+	}
+	if err = quota.Reserve(1, 424); err != nil {
+		t.Fatal(err)
+	}
+	if err = quota.Check(1); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("Check of spent company = %v", err)
+	}
+	if err = quota.Reserve(2, 1025); !errors.Is(err, errQuotaExceeded) || !strings.Contains(err.Error(), "class") {
+		t.Fatalf("Reserve over class budget = %v", err)
+	}
+
+	// Released bytes can be reserved again
+	quota.Release(1, 424)
+	if err = quota.Check(1); err != nil {
+		t.Fatal(err)
+	}
+	if err = quota.Reserve(3, 1024); err != nil || quota.Full() {
+		t.Fatalf("Reserve = %v, full %v", err, quota.Full())
+	}
+	if err = quota.Reserve(3, 1); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("Reserve over company budget = %v", err)
+	}
+	if err = quota.Reserve(2, 936); err != nil {
+		t.Fatal(err)
+	}
+	if err = quota.Reserve(1, 1); !errors.Is(err, errQuotaExceeded) || !strings.Contains(err.Error(), "global") {
+		t.Fatalf("Reserve over global budget = %v", err)
+	}
+	if !quota.Full() {
+		t.Fatal("spent global budget is not full")
+	}
+
+	if quota, err = NewQuota(quotaConfig{}, nil, nil); quota != nil || err != nil || quota.Reserve(1, 1<<40) != nil {
+		t.Fatalf("quota without budgets = %v, %v", quota, err)
+	}
+}
+
+func TestQuotaStopsCrawler(t *testing.T) {
+	memory := classifiedMemory()
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)
+	var err error
+	store.Quota, err = NewQuota(quotaConfig{Company: "1KB"}, memory.GetCompanies(), memory.DocumentTotals())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Document which doesn't fit is not saved and its bytes are not taken
+	if _, err = store.Save(d.Documents{CompanyID: 1, Crawler: "wayback"}, make([]byte, 1000), "wayback/Banks/a.com/a.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Save(d.Documents{CompanyID: 1, Crawler: "wayback"}, make([]byte, 100), "wayback/Banks/a.com/b.html", nil); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("Save over quota = %v", err)
+	}
+	if found, _ := store.Storage.Exists("wayback/Banks/a.com/b.html"); found || len(memory.GetDocuments()) != 1 {
+		t.Fatal("document over quota is saved")
+	}
+	if _, err = store.Save(d.Documents{CompanyID: 1, Crawler: "wayback"}, make([]byte, 24), "wayback/Banks/a.com/c.html", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crawler stops with company which has no budget left and the company is not finished
+	results := make(chan ArchiveResultChan, 2)
+	FetchWayback(memory.GetCompanies()[0], "wayback/Banks/a.com", WaybackConfig{ResChanel: results, Store: store})
+	if result := <-results; !errors.Is(result.Error, errQuotaExceeded) {
+		t.Fatalf("first result = %+v", result)
+	}
+	if result := <-results; !result.Done || !result.Stopped {
+		t.Fatalf("last result = %+v", result)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for size, bytes := range map[string]int64{"": 0, "500": 500 << 20, "2 GB": 2 << 30, "1.5kb": 1536, "1TB": 1 << 40, " 10 MB ": 10 << 20} {
+		if parsed, err := parseSize(size); err != nil || parsed != bytes {
+			t.Errorf("parseSize(%q) = %v, %v, want %v", size, parsed, err, bytes)
+		}
+	}
+	for _, size := range []string{"ten MB", "-1GB", "5 PB"} {
+		if _, err := parseSize(size); err == nil {
+			t.Errorf("parseSize(%q): error is expected", size)
+		}
+	}
+	if formatSize(-5) != "0.0 MB" || formatSize(3<<19) != "1.5 MB" || formatSize(5<<29) != "2.5 GB" {
+		t.Error("sizes are formatted wrong")
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	d "./db"
+)
+
+// Phrases of pages which are shown by registrars and parking services instead of real sites
+var parkedPhrases = [][]byte{
+	[]byte("domain is for sale"), []byte("domain may be for sale"), []byte("buy this domain"),
+	[]byte("this domain is parked"), []byte("domain parking"), []byte("parked free"), []byte("parkingcrew"),
+	[]byte("sedoparking"), []byte("bodis.com"), []byte("hugedomains.com"), []byte("afternic"),
+	[]byte("this domain has expired"), []byte("domain has expired"), []byte("renew this domain"),
+	[]byte("домен продается"), []byte("домен продаётся"), []byte("домен припаркован"), []byte("срок регистрации домена истек"),
+}
+
+// Liveness statuses from the best to the worst. Check of site returns the best status of its variants
+var livenessRank = map[string]int{
+	d.LivenessLive: 0, d.LivenessRedirected: 1, d.LivenessParked: 2, d.LivenessHTTPError: 3,
+	d.LivenessTLSError: 4, d.LivenessRefused: 5, d.LivenessUnreachable: 6, d.LivenessDNSFailure: 7,
+}
+
+// Resolver ... Checks liveness of sites and finds scheme and host under which they respond before they are crawled
+type Resolver struct {
+	Client *http.Client
+}
+
+// SiteCheck ... Result of site check. Scheme and host are empty if site doesn't respond,
+// location is set if site redirects to another domain
+type SiteCheck struct {
+	Liveness string
+	Scheme   string
+	Host     string
+	Location string
+	Error    error
+}
+
+// NewResolver ... Creates resolver with request timeout. Certificates are not verified like by crawlers
+func NewResolver(timeout time.Duration) *Resolver {
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	return &Resolver{Client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// sameSite ... Checks whether host belongs to the same registrable domain as domain, e.g. `shop.example.com`
+// and `example.com`
+func sameSite(host string, domain string) bool {
+	if name, _, err := net.SplitHostPort(domain); err == nil {
+		domain = name
+	}
+	return d.RegistrableDomain(strings.ToLower(host)) == d.RegistrableDomain(strings.ToLower(domain))
+}
+
+// movedTo ... Returns canonical domain of location to which site of domain redirects, empty if location
+// belongs to the same registrable domain
+func movedTo(domain string, location string) string {
+	target, err := d.NormalizeDomain(location)
+	if err != nil || sameSite(target, domain) {
+		return ""
+	}
+	return target
+}
+
+// isParked ... Checks whether page is shown by parking service or registrar instead of site
+func isParked(body []byte) bool {
+	body = bytes.ToLower(body)
+	for _, phrase := range parkedPhrases {
+		if bytes.Contains(body, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorLiveness ... Classifies error of request
+func errorLiveness(err error) string {
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &dnsErr):
+		return d.LivenessDNSFailure
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return d.LivenessRefused
+	case errors.As(err, &recordErr) || strings.Contains(err.Error(), "tls: ") || strings.Contains(err.Error(), "x509: "):
+		return d.LivenessTLSError
+	}
+	return d.LivenessUnreachable
+}
+
+// checkURL ... Requests start page of site variant and classifies response
+func (r *Resolver) checkURL(base string, domain string) SiteCheck {
+	req, err := http.NewRequest("GET", base+"/", nil)
+	if err != nil {
+		return SiteCheck{Liveness: d.LivenessUnreachable, Error: err}
+	}
+	req.Header.Set("User-Agent", randomOption(userAgents))
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return SiteCheck{Liveness: errorLiveness(err), Error: err}
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	// Site moved to another domain keeps the variant which was requested
+	final := resp.Request.URL
+	check := SiteCheck{Scheme: final.Scheme, Host: final.Host}
+	if !sameSite(final.Hostname(), domain) {
+		check = SiteCheck{Liveness: d.LivenessRedirected, Scheme: req.URL.Scheme, Host: req.URL.Host, Location: final.String()}
+		return check
+	}
+	switch {
+	case resp.StatusCode >= 400:
+		check.Liveness = d.LivenessHTTPError
+		check.Error = fmt.Errorf("%v", resp.Status)
+	case isParked(body):
+		check.Liveness = d.LivenessParked
+	default:
+		check.Liveness = d.LivenessLive
+	}
+	return check
+}
+
+// Check ... Tries HTTPS and HTTP with and without `www.` and classifies site by the best responding variant.
+// Redirects within the same site are followed, so final scheme and host are returned
+func (r *Resolver) Check(domain string) SiteCheck {
+	var best SiteCheck
+	for i, base := range d.SiteVariants(domain) {
+		check := r.checkURL(base, domain)
+		if i == 0 || livenessRank[check.Liveness] < livenessRank[best.Liveness] {
+			best = check
+		}
+		if best.Liveness == d.LivenessLive {
+			break
+		}
+	}
+	return best
+}
+
+// Resolve ... Returns scheme and host under which site responds
+func (r *Resolver) Resolve(domain string) (string, string, error) {
+	check := r.Check(domain)
+	if check.Host == "" {
+		return "", "", fmt.Errorf("[Resolve] %v: %v", domain, check.Error)
+	}
+	return check.Scheme, check.Host, nil
+}
+
+// ResolveSites ... Checks liveness of sites of companies which are not checked yet, all of them if `Refresh` is set.
+// Scheme and host are recorded for sites which respond, live domains to which sites redirect are added to companies
+func (m Miner) ResolveSites(config resolverConfig) {
+	type site struct {
+		companyID int
+		domain    string
+	}
+	sites := make(chan site)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	counts := map[string]int{}
+
+	resolver := NewResolver(time.Second * time.Duration(config.Timeout))
+	for i := 0; i < config.Workers || i == 0; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range sites {
+				checked := m.checkSite(resolver, s.companyID, s.domain, config.Debug)
+				mutex.Lock()
+				for _, liveness := range checked {
+					counts[liveness]++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, c := range m.db.GetCompanies() {
+		for _, domain := range c.Sites() {
+			if _, found := c.Checked[domain]; !found || config.Refresh {
+				sites <- site{c.ID, domain}
+			}
+		}
+	}
+	close(sites)
+	wg.Wait()
+
+	statuses := []string{}
+	for liveness := range counts {
+		statuses = append(statuses, liveness)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return livenessRank[statuses[i]] < livenessRank[statuses[j]] })
+	for _, liveness := range statuses {
+		fmt.Printf("Sites checked as %v: %v\n", liveness, counts[liveness])
+	}
+}
+
+// hasSite ... Checks whether domain is one of sites of company
+func hasSite(c d.Companies, domain string) bool {
+	for _, site := range c.Sites() {
+		if site == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSite ... Checks liveness of site of company and records it. Site which moved to another domain, e.g. after
+// rebranding, is followed there, and new domain is recorded as alias of company if it is live. All crawlers cover it
+// as other domains of company. Returns liveness of checked sites
+func (m Miner) checkSite(resolver *Resolver, companyID int, domain string, debug bool) []string {
+	check := resolver.Check(domain)
+	err := m.db.SetChecked(companyID, domain, check.Liveness, check.Scheme, check.Host, check.Location)
+	if debug && check.Liveness != d.LivenessLive {
+		fmt.Printf("Site %v: %v %v %v\n", domain, check.Liveness, check.Location, check.Error)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	alias := movedTo(domain, check.Location)
+	if check.Liveness != d.LivenessRedirected || alias == "" {
+		return []string{check.Liveness}
+	}
+	moved := resolver.Check(alias)
+	if moved.Liveness != d.LivenessLive {
+		if debug {
+			fmt.Printf("Site %v moved to %v: %v %v\n", domain, alias, moved.Liveness, moved.Error)
+		}
+		return []string{check.Liveness}
+	}
+	added, err := m.db.AddDomain(companyID, alias, d.DomainRedirect)
+	if err != nil {
+		fmt.Println(err)
+	} else if added {
+		fmt.Printf("Site %v moved to %v\n", domain, alias)
+		if err = m.db.SetChecked(companyID, alias, moved.Liveness, moved.Scheme, moved.Host, moved.Location); err != nil {
+			fmt.Println(err)
+		}
+		return []string{check.Liveness, moved.Liveness}
+	}
+	return []string{check.Liveness}
+}
+
+// deadStatuses ... Returns set of liveness statuses which mean that site is dead
+func deadStatuses(config resolverConfig) map[string]bool {
+	dead := map[string]bool{}
+	for _, liveness := range config.Dead {
+		dead[liveness] = true
+	}
+	return dead
+}
+
+// crawlable ... Drops companies whose sites are all dead. Web archives keep pages of dead sites,
+// so archive crawlers drop them only if dead sites are skipped at all
+func (m Miner) crawlable(companies []d.Companies, archive bool) []d.Companies {
+	if m.deadSites == "" || m.deadSites == "crawl" || (archive && m.deadSites == "archive") {
+		return companies
+	}
+	alive := []d.Companies{}
+	for _, c := range companies {
+		if !c.Dead(m.dead) {
+			alive = append(alive, c)
+		}
+	}
+	return alive
+}
+
+// startURLs ... Returns URLs from which sites of company which are not dead are crawled
+func (m Miner) startURLs(c d.Companies) []string {
+	urls := []string{}
+	for _, site := range c.Sites() {
+		liveness, found := c.Checked[site]
+		if found && m.dead[liveness] && m.deadSites != "crawl" {
+			continue
+		}
+		if liveness != d.LivenessRedirected {
+			urls = append(urls, c.StartURL(site))
+			continue
+		}
+
+		// Moved site is crawled from where it redirects if resolver recorded new domain as alias of company.
+		// Otherwise site moved to another company or to dead site
+		if alias := movedTo(site, c.Moved[site]); alias == "" {
+			urls = append(urls, c.StartURL(site))
+		} else if hasSite(c, alias) {
+			urls = append(urls, c.Moved[site])
+		}
+	}
+	return urls
+}
+
+// fallbackURLs ... Returns other base URLs of sites which are not resolved yet by their start URLs, e.g. if resolver
+// is turned off. Crawler tries them if little is loaded from start URL, since site may respond only under HTTP or `www.`
+func fallbackURLs(c d.Companies, starts []string) map[string][]string {
+	fallbacks := map[string][]string{}
+	for _, site := range c.Sites() {
+		variants := c.BaseURLs(site)
+		for _, start := range starts {
+			if len(variants) > 1 && start == variants[0] {
+				fallbacks[start] = variants[1:]
+			}
+		}
+	}
+	return fallbacks
+}
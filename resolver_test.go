@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	d "./db"
+)
+
+func TestMovedSiteStarts(t *testing.T) {
+	memory := d.NewMemory([]d.Companies{
+		{URL: "a.com", Domains: []string{"a-new.com"}},
+		{URL: "b.com"},
+		{URL: "c.com"},
+		{URL: "d.com"},
+	}, nil)
+	memory.SetChecked(1, "a.com", d.LivenessRedirected, "https", "a.com", "https://www.a-new.com/home")
+	memory.SetChecked(1, "a-new.com", d.LivenessLive, "https", "www.a-new.com", "")
+	memory.SetChecked(2, "b.com", d.LivenessRedirected, "https", "b.com", "https://c.com/")
+	memory.SetChecked(3, "c.com", d.LivenessLive, "https", "c.com", "")
+	memory.SetChecked(4, "d.com", d.LivenessRedirected, "http", "d.com", "http://gone.com/")
+	m := Miner{db: memory}
+
+	// Moved site starts where it redirects, unless new domain is not alias of company
+	want := [][]string{{"https://www.a-new.com/home", "https://www.a-new.com"}, {}, {"https://c.com"}, {}}
+	for i, c := range memory.GetCompanies() {
+		if got := m.startURLs(c); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("startURLs(%v) = %v, want %v", c.URL, got, want[i])
+		}
+	}
+}
+
+// fakeDNS ... Returns resolver which connects to test servers instead of hosts of names
+func fakeDNS(servers map[string]*httptest.Server) *Resolver {
+	resolver := NewResolver(2 * time.Second)
+	dialer := &net.Dialer{}
+	resolver.Client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(addr)
+		server, found := servers[host]
+		if !found {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}}
+	return resolver
+}
+
+func TestRedirectAlias(t *testing.T) {
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>New brand</html>"))
+	}))
+	defer live.Close()
+	parked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>This domain is for sale!</html>"))
+	}))
+	defer parked.Close()
+	moved := httptest.NewServer(http.RedirectHandler("http://new.com/", http.StatusMovedPermanently))
+	defer moved.Close()
+	sold := httptest.NewServer(http.RedirectHandler("http://sold.com/", http.StatusMovedPermanently))
+	defer sold.Close()
+	taken := httptest.NewServer(http.RedirectHandler("http://other.com/", http.StatusMovedPermanently))
+	defer taken.Close()
+	resolver := fakeDNS(map[string]*httptest.Server{"old.com": moved, "new.com": live, "shop.com": sold, "sold.com": parked,
+		"merged.com": taken, "other.com": live})
+
+	memory := d.NewMemory([]d.Companies{{URL: "old.com"}, {URL: "shop.com"}, {URL: "merged.com"}, {URL: "other.com"}}, nil)
+	m := Miner{db: memory}
+	for _, c := range memory.GetCompanies() {
+		m.checkSite(resolver, c.ID, c.URL, false)
+	}
+
+	// Only live domain which doesn't belong to another company becomes alias
+	companies := memory.GetCompanies()
+	if c := companies[0]; c.Checked["old.com"] != d.LivenessRedirected || !reflect.DeepEqual(c.Domains, []string{"new.com"}) ||
+		c.Checked["new.com"] != d.LivenessLive || c.Moved["old.com"] != "http://new.com/" {
+		t.Fatalf("site moved to live domain: %+v", c)
+	}
+	for _, c := range companies[1:3] {
+		if c.Checked[c.URL] != d.LivenessRedirected || len(c.Domains) != 0 {
+			t.Fatalf("site moved to parked domain or another company: %+v", c)
+		}
+		if starts := m.startURLs(c); len(starts) != 0 {
+			t.Fatalf("startURLs(%v) = %v", c.URL, starts)
+		}
+	}
+}
+
+func TestDeadSitePolicy(t *testing.T) {
+	memory := d.NewMemory([]d.Companies{
+		{URL: "a.com", Domains: []string{"a.ru"}},
+		{URL: "b.com", Domains: []string{"b.ru"}},
+		{URL: "c.com"},
+	}, nil)
+	memory.SetChecked(1, "a.com", d.LivenessLive, "https", "a.com", "")
+	memory.SetChecked(1, "a.ru", d.LivenessParked, "http", "a.ru", "")
+	memory.SetChecked(2, "b.com", d.LivenessParked, "http", "b.com", "")
+	memory.SetChecked(2, "b.ru", d.LivenessUnreachable, "", "", "")
+	companies := memory.GetCompanies()
+	dead := deadStatuses(resolverConfig{Dead: []string{d.LivenessParked, d.LivenessUnreachable}})
+
+	// Company is dead only if all its sites are dead, unchecked site is not dead
+	for _, test := range []struct {
+		deadSites string
+		live      int
+		archived  int
+		starts    []string
+	}{
+		{"", 3, 3, []string{"https://a.com"}},
+		{"crawl", 3, 3, []string{"https://a.com", "http://a.ru"}},
+		{"archive", 2, 3, []string{"https://a.com"}},
+		{"skip", 2, 2, []string{"https://a.com"}},
+	} {
+		m := Miner{db: memory, dead: dead, deadSites: test.deadSites}
+		if live, archived := m.crawlable(companies, false), m.crawlable(companies, true); len(live) != test.live ||
+			len(archived) != test.archived {
+			t.Errorf("dead_sites %q: crawled %v, archived %v", test.deadSites, len(live), len(archived))
+		}
+		if starts := m.startURLs(companies[0]); !reflect.DeepEqual(starts, test.starts) {
+			t.Errorf("dead_sites %q: startURLs = %v, want %v", test.deadSites, starts, test.starts)
+		}
+	}
+}
+
+func TestSiteLiveness(t *testing.T) {
+	page := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+	}
+	live := page(http.StatusOK, "<html>Annual reports</html>")
+	defer live.Close()
+	secure := httptest.NewTLSServer(live.Config.Handler)
+	defer secure.Close()
+	parked := page(http.StatusOK, "<html>Buy this domain</html>")
+	defer parked.Close()
+	failing := page(http.StatusServiceUnavailable, "<html>Maintenance</html>")
+	defer failing.Close()
+	moved := httptest.NewServer(http.RedirectHandler("http://new.com/home", http.StatusFound))
+	defer moved.Close()
+	// Site responds only under `www.`, other variants are not found
+	www := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "www.") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("<html>Company</html>"))
+	}))
+	defer www.Close()
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refused.Close()
+	resolver := fakeDNS(map[string]*httptest.Server{"live.com": live, "secure.com": secure, "www.secure.com": secure,
+		"parked.com": parked, "failing.com": failing, "moved.com": moved, "new.com": live, "shop.com": www, "www.shop.com": www,
+		"refused.com": refused})
+
+	tests := []struct {
+		domain, liveness, scheme, host, location string
+	}{
+		{"live.com", d.LivenessLive, "http", "live.com", ""},
+		{"secure.com", d.LivenessLive, "https", "secure.com", ""},
+		{"shop.com", d.LivenessLive, "http", "www.shop.com", ""},
+		{"parked.com", d.LivenessParked, "http", "parked.com", ""},
+		{"failing.com", d.LivenessHTTPError, "http", "failing.com", ""},
+		{"moved.com", d.LivenessRedirected, "http", "moved.com", "http://new.com/home"},
+		{"refused.com", d.LivenessRefused, "", "", ""},
+		{"missing.com", d.LivenessDNSFailure, "", "", ""},
+	}
+	companies := []d.Companies{}
+	for _, test := range tests {
+		companies = append(companies, d.Companies{URL: test.domain})
+	}
+	memory := d.NewMemory(companies, nil)
+	m := Miner{db: memory}
+	for i, test := range tests {
+		// Live domain where site moved is checked too
+		if checked := m.checkSite(resolver, i+1, test.domain, false); checked[0] != test.liveness {
+			t.Errorf("%v: checked %v, want %v", test.domain, checked, test.liveness)
+		}
+	}
+
+	// Classification is stored on company, start URL of responding site is where it was found
+	for i, c := range memory.GetCompanies() {
+		test := tests[i]
+		if c.Liveness != test.liveness || c.Scheme != test.scheme || c.Host != test.host || c.Location != test.location ||
+			c.CheckedAt == nil {
+			t.Errorf("%v: company %+v, want %+v", test.domain, c, test)
+		}
+		if test.host != "" && c.StartURL(c.URL) != test.scheme+"://"+test.host {
+			t.Errorf("%v: start URL %v", test.domain, c.StartURL(c.URL))
+		}
+	}
+}
+
+func TestErrorLiveness(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		liveness string
+	}{
+		{&net.DNSError{Err: "no such host", Name: "a.com", IsNotFound: true}, d.LivenessDNSFailure},
+		{fmt.Errorf("get: %w", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), d.LivenessRefused},
+		{tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, d.LivenessTLSError},
+		{errors.New("x509: certificate has expired or is not yet valid"), d.LivenessTLSError},
+		{errors.New("remote error: tls: handshake failure"), d.LivenessTLSError},
+		{errors.New("context deadline exceeded"), d.LivenessUnreachable},
+	} {
+		if liveness := errorLiveness(test.err); liveness != test.liveness {
+			t.Errorf("errorLiveness(%v) = %v, want %v", test.err, liveness, test.liveness)
+		}
+	}
+}
+
+func TestFallbackURLs(t *testing.T) {
+	memory := d.NewMemory([]d.Companies{{URL: "a.com", Domains: []string{"a.ru", "ir.a.com"}}}, nil)
+	memory.SetChecked(1, "a.ru", d.LivenessLive, "http", "www.a.ru", "")
+	memory.SetChecked(1, "ir.a.com", d.LivenessDNSFailure, "", "", "")
+	m := Miner{db: memory, dead: deadStatuses(resolverConfig{Dead: []string{d.LivenessDNSFailure}}), deadSites: "archive"}
+	c := memory.GetCompanies()[0]
+
+	// Only sites which are not resolved have fallbacks, dead sites are not crawled at all
+	starts := m.startURLs(c)
+	if want := []string{"https://a.com", "http://www.a.ru"}; !reflect.DeepEqual(starts, want) {
+		t.Fatalf("startURLs = %v, want %v", starts, want)
+	}
+	want := map[string][]string{"https://a.com": {"https://www.a.com", "http://a.com", "http://www.a.com"}}
+	if fallbacks := fallbackURLs(c, starts); !reflect.DeepEqual(fallbacks, want) {
+		t.Errorf("fallbackURLs = %v, want %v", fallbacks, want)
+	}
+}
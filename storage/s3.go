@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Object metadata header which marks reference to another object
+const s3LinkHeader = "X-Amz-Meta-Link"
+
+// Payload hash of requests whose body is not signed
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 ... Storage in S3-compatible object storage (AWS S3, MinIO and others).
+// Objects are addressed in path style: endpoint/bucket/prefix/name
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	HTTP      *http.Client
+}
+
+// NewS3 ... Creates S3 storage and makes bucket if it doesn't exist. Endpoint is like `http://localhost:9000`
+func NewS3(endpoint, bucket, prefix, region, accessKey, secretKey string) (*S3, error) {
+	if region == "" {
+		region = "us-east-1"
+	}
+	s := &S3{Endpoint: strings.TrimRight(endpoint, "/"), Bucket: bucket, Prefix: strings.Trim(prefix, "/"),
+		Region: region, AccessKey: accessKey, SecretKey: secretKey, HTTP: &http.Client{Timeout: 10 * time.Minute}}
+
+	resp, err := s.do("HEAD", "", nil, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("[NewS3] error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		resp, err = s.do("PUT", "", nil, 0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("[NewS3] error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("[NewS3] can't create bucket %v: %v", bucket, s3Error(resp))
+		}
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[NewS3] bucket %v is not accessible: %v", bucket, resp.Status)
+	}
+	return s, nil
+}
+
+func (s *S3) key(name string) string {
+	return path.Join(s.Prefix, name)
+}
+
+// Put ... Uploads object
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	resp, err := s.do("PUT", s.key(name), r, size, nil)
+	if err != nil {
+		return fmt.Errorf("[Put] error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[Put] %v: %v", name, s3Error(resp))
+	}
+	return nil
+}
+
+// Get ... Downloads object, reference objects are resolved to their targets
+func (s *S3) Get(name string) ([]byte, error) {
+	resp, err := s.do("GET", s.key(name), nil, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("[Get] error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[Get] %v: %v", name, s3Error(resp))
+	}
+	if target := resp.Header.Get(s3LinkHeader); target != "" {
+		return s.Get(target)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Exists ... Checks whether object exists
+func (s *S3) Exists(name string) (bool, error) {
+	resp, err := s.do("HEAD", s.key(name), nil, 0, nil)
+	if err != nil {
+		return false, fmt.Errorf("[Exists] error: %v", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("[Exists] %v: %v", name, resp.Status)
+}
+
+// Link ... Saves empty object which refers to target in its metadata, so content is stored only once
+func (s *S3) Link(target string, name string) error {
+	header := http.Header{}
+	header.Set(s3LinkHeader, target)
+	resp, err := s.do("PUT", s.key(name), nil, 0, header)
+	if err != nil {
+		return fmt.Errorf("[Link] error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[Link] %v: %v", name, s3Error(resp))
+	}
+	return nil
+}
+
+// do ... Sends signed request for object `key`, empty key means bucket itself
+func (s *S3) do(method string, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	rawURL := s.Endpoint + "/" + s3Escape(s.Bucket)
+	if key != "" {
+		rawURL += "/" + s3Escape(key)
+	}
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if method == "PUT" {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	signV4(req, s.AccessKey, s.SecretKey, s.Region, time.Now())
+	return s.HTTP.Do(req)
+}
+
+// s3Error ... Returns error code from S3 XML response
+func s3Error(resp *http.Response) string {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	text := string(body)
+	if from := strings.Index(text, "<Code>"); from >= 0 {
+		if to := strings.Index(text[from:], "</Code>"); to >= 0 {
+			return resp.Status + " " + text[from+len("<Code>"):from+to]
+		}
+	}
+	return resp.Status
+}
+
+// s3Escape ... URI-encodes object key as required by S3 signature, slashes are kept
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 ... Signs request with AWS Signature Version 4. All headers of request are signed,
+// `X-Amz-Content-Sha256` should be already set
+func signV4(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, s3Escape(k)+"="+strings.Replace(s3Escape(v), "/", "%2F", -1))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), strings.Join(params, "&"),
+		canonicalHeaders.String(), signedHeaders, req.Header.Get("X-Amz-Content-Sha256")}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
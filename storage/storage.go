@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Storage ... Place where collected files are kept. Names are slash separated paths relative to the storage root
+type Storage interface {
+	// Put ... Saves content under the name, existing object is replaced
+	Put(name string, r io.Reader, size int64) error
+	// Get ... Returns content of the object, references are followed
+	Get(name string) ([]byte, error)
+	// Exists ... Checks whether object with the name is stored
+	Exists(name string) (bool, error)
+	// Link ... Makes `name` a reference to already stored `target`
+	Link(target string, name string) error
+}
+
+// Local ... Storage in local file system
+type Local struct {
+	Root string
+}
+
+// NewLocal ... Creates local storage in `root` folder, empty root means current directory
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+func (s *Local) path(name string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(name))
+}
+
+// Put ... Writes content into file atomically, parent folders are created when needed
+func (s *Local) Put(name string, r io.Reader, size int64) error {
+	filename := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("[Put] error: %v", err)
+	}
+	if err := WriteFile(filename, r); err != nil {
+		return fmt.Errorf("[Put] error: %v", err)
+	}
+	return nil
+}
+
+// WriteFile ... Writes content into temporary file in the same folder, syncs it to disk and renames it
+// into place. So file either has complete content or doesn't exist, even if process is killed
+func WriteFile(filename string, r io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// Get ... Reads content of file
+func (s *Local) Get(name string) ([]byte, error) {
+	return ioutil.ReadFile(s.path(name))
+}
+
+// Exists ... Checks whether file exists
+func (s *Local) Exists(name string) (bool, error) {
+	_, err := os.Lstat(s.path(name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Link ... Makes relative symlink to target, hard link is used if symlinks are not supported
+func (s *Local) Link(target string, name string) error {
+	filename := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("[Link] error: %v", err)
+	}
+	rel, err := filepath.Rel(filepath.Dir(filename), s.path(target))
+	if err == nil {
+		if err = os.Symlink(rel, filename); err == nil {
+			return nil
+		}
+	}
+	if err = os.Link(s.path(target), filename); err != nil {
+		return fmt.Errorf("[Link] error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingReader ... Returns part of content and then fails
+type failingReader struct {
+	sent bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+	r.sent = true
+	return copy(p, "partial"), nil
+}
+
+// folderFiles ... Returns names of files in folder
+func folderFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "report.pdf")
+	if err := WriteFile(filename, strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(filename, strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil || string(content) != "second" {
+		t.Fatalf("content = %q, %v", content, err)
+	}
+	if info, _ := os.Stat(filename); info.Mode().Perm() != 0644 {
+		t.Fatalf("mode = %v", info.Mode())
+	}
+
+	// Failed write leaves previous content and no temporary files
+	if err = WriteFile(filename, &failingReader{}); err == nil {
+		t.Fatal("error of reader is lost")
+	}
+	if content, _ = ioutil.ReadFile(filename); string(content) != "second" {
+		t.Fatalf("content after failed write = %q", content)
+	}
+	if files := folderFiles(t, dir); len(files) != 1 || files[0] != "report.pdf" {
+		t.Fatalf("files = %v", files)
+	}
+	if err = WriteFile(filepath.Join(dir, "missing", "report.pdf"), strings.NewReader("text")); err == nil {
+		t.Fatal("file is written into missing folder")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocal(dir)
+	if err := s.Put("blobs/ab/report.pdf", strings.NewReader("report"), 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Link("blobs/ab/report.pdf", "colly/Tech/a.com/report.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"blobs/ab/report.pdf", "colly/Tech/a.com/report.pdf"} {
+		content, err := s.Get(name)
+		if err != nil || string(content) != "report" {
+			t.Fatalf("Get(%v) = %q, %v", name, content, err)
+		}
+		if found, err := s.Exists(name); !found || err != nil {
+			t.Fatalf("Exists(%v) = %v, %v", name, found, err)
+		}
+	}
+	if found, err := s.Exists("missing.pdf"); found || err != nil {
+		t.Fatalf("Exists of missing file = %v, %v", found, err)
+	}
+
+	// Folder can't be replaced by file
+	if err := s.Put("blobs", strings.NewReader("text"), 4); err == nil {
+		t.Fatal("folder is replaced")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	d "./db"
+	"./storage"
+)
+
+// BlobStore ... Content-addressed area of storage. Each unique file is kept once under its SHA-256 hash,
+// while company folders only reference it
+type BlobStore struct {
+	Storage storage.Storage
+	Root    string
+}
+
+// DocumentStore ... Saves collected documents through storage backend and records them in manifest.
+// Without blob store files are saved directly into company folders. Documents which don't fit into quota
+// or belong to saturated class are not saved
+type DocumentStore struct {
+	Storage storage.Storage
+	Blobs   *BlobStore
+	Quota   *Quota
+	Balance *Balance
+	DB      d.Repository
+}
+
+// Suffix of sidecar file which describes saved document
+const metaSuffix = ".meta.json"
+
+// Metadata ... Content of `.meta.json` sidecar saved next to each document, so file can be traced back
+// to its source without database
+type Metadata struct {
+	URL          string      `json:"url"`
+	Crawler      string      `json:"crawler"`
+	FetchedAt    time.Time   `json:"fetched_at"`
+	CapturedAt   *time.Time  `json:"captured_at,omitempty"`
+	Snapshot     string      `json:"snapshot,omitempty"`
+	Headers      http.Header `json:"headers,omitempty"`
+	DetectedType string      `json:"detected_type"`
+	SHA256       string      `json:"sha256"`
+	Size         int64       `json:"size"`
+	Truncated    bool        `json:"truncated,omitempty"`
+}
+
+// NewStorage ... Creates storage backend from configuration
+func NewStorage(config storageConfig) (storage.Storage, error) {
+	switch config.Backend {
+	case "", "local":
+		return storage.NewLocal(config.Root), nil
+	case "s3":
+		s, err := storage.NewS3(config.Endpoint, config.Bucket, config.Prefix, config.Region, config.AccessKey, config.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("[NewStorage] error: %v", err)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("[NewStorage] unknown backend: %v", config.Backend)
+}
+
+// NewDocumentStore ... Creates document store writing into backend, content-addressed if configured
+func NewDocumentStore(config storageConfig, backend storage.Storage, db d.Repository) *DocumentStore {
+	store := &DocumentStore{Storage: backend, DB: db}
+	if config.ContentAddressed {
+		store.Blobs = &BlobStore{Storage: backend, Root: config.Blobs}
+	}
+	return store
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *BlobStore) blobPath(hash string) string {
+	return path.Join(s.Root, hash[:2], hash[2:4], hash)
+}
+
+// Put ... Saves content as blob if it is not stored yet and returns name of the blob
+func (s *BlobStore) Put(hash string, content []byte) (string, error) {
+	blob := s.blobPath(hash)
+	if found, err := s.Storage.Exists(blob); err != nil || found {
+		return blob, err
+	}
+	return blob, s.Storage.Put(blob, bytes.NewReader(content), int64(len(content)))
+}
+
+// PutFile ... Moves local file into blobs. The file is just removed if the same blob exists
+func (s *BlobStore) PutFile(hash string, filename string) (string, error) {
+	blob := s.blobPath(hash)
+	found, err := s.Storage.Exists(blob)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		if err = putFile(s.Storage, blob, filename); err != nil {
+			return "", err
+		}
+	}
+	return blob, os.Remove(filename)
+}
+
+// putFile ... Uploads local file into storage
+func putFile(backend storage.Storage, name string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("[putFile] error: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("[putFile] error: %v", err)
+	}
+	return backend.Put(name, f, info.Size())
+}
+
+// Check ... Returns error if documents of company can't be saved anymore because of quota or class target
+func (s *DocumentStore) Check(companyID int) error {
+	if err := s.Quota.Check(companyID); err != nil {
+		return err
+	}
+	return s.Balance.Check(companyID)
+}
+
+// addDocument ... Records saved document in manifest and counts it for class balance
+func (s *DocumentStore) addDocument(doc d.Documents) error {
+	if err := s.DB.AddDocument(&doc); err != nil {
+		return err
+	}
+	s.Balance.Add(doc.CompanyID, doc.Size)
+	return nil
+}
+
+// isSaved ... Checks if document is already saved under `name`. Name is made from URL, so the same URL
+// is saved in folder only once
+func (s *DocumentStore) isSaved(name string) (bool, error) {
+	found, err := s.Storage.Exists(name)
+	if err != nil {
+		return false, fmt.Errorf("[isSaved] error: %v", err)
+	}
+	return found, nil
+}
+
+// saveMeta ... Writes sidecar of saved document
+func (s *DocumentStore) saveMeta(name string, doc d.Documents, header http.Header, detectedType string) error {
+	meta := Metadata{URL: doc.URL, Crawler: doc.Crawler, FetchedAt: time.Now().UTC(), Snapshot: doc.Snapshot,
+		Headers: header, DetectedType: detectedType, SHA256: doc.Hash, Size: doc.Size, Truncated: doc.Truncated}
+	if !doc.CapturedAt.IsZero() {
+		meta.CapturedAt = &doc.CapturedAt
+	}
+	var content bytes.Buffer
+	encoder := json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(meta); err != nil {
+		return err
+	}
+	return s.Storage.Put(name+metaSuffix, &content, int64(content.Len()))
+}
+
+// documentName ... Returns name of document file made from its URL in `folder`
+func documentName(folder string, rawURL string, extension string) string {
+	return path.Join(folder, EscapeURL(rawURL)+extension)
+}
+
+// Save ... Saves content of collected document with its sidecar and records it in manifest. With content-addressed
+// storage the same content is saved in company folder only once. Returns name of saved file or empty string for duplicate
+// or already saved URL
+func (s *DocumentStore) Save(doc d.Documents, content []byte, name string, header http.Header) (string, error) {
+	doc.Hash = contentHash(content)
+	doc.Size = int64(len(content))
+
+	if s.Blobs != nil && s.DB.HasDocument(doc.Hash, path.Dir(name)) {
+		return "", nil
+	}
+	saved, err := s.isSaved(name)
+	if err != nil || saved {
+		return "", err
+	}
+	if err = s.Balance.Check(doc.CompanyID); err != nil {
+		return "", err
+	}
+	if err = s.Quota.Reserve(doc.CompanyID, doc.Size); err != nil {
+		return "", err
+	}
+	if s.Blobs == nil {
+		err = s.Storage.Put(name, bytes.NewReader(content), doc.Size)
+	} else {
+		var blob string
+		if blob, err = s.Blobs.Put(doc.Hash, content); err == nil {
+			err = s.Storage.Link(blob, name)
+		}
+	}
+	if err == nil {
+		err = s.saveMeta(name, doc, header, http.DetectContentType(content))
+	}
+	if err != nil {
+		s.Quota.Release(doc.CompanyID, doc.Size)
+		return "", fmt.Errorf("[Save] error: %v", err)
+	}
+
+	doc.Path = name
+	return name, s.addDocument(doc)
+}
+
+// SaveDownloaded ... Moves downloaded local file into storage under `name`, writes its sidecar and records it
+// in manifest. Returns name of saved file or empty string for duplicate or already saved URL
+func (s *DocumentStore) SaveDownloaded(doc d.Documents, file DownloadResult, name string) (string, error) {
+	doc.Hash = file.SHA256
+	doc.Size = file.Size
+	doc.Truncated = file.Truncated
+
+	if s.Blobs != nil && s.DB.HasDocument(doc.Hash, path.Dir(name)) {
+		return "", os.Remove(file.Path)
+	}
+	saved, err := s.isSaved(name)
+	if err != nil {
+		os.Remove(file.Path)
+		return "", err
+	} else if saved {
+		return "", os.Remove(file.Path)
+	}
+	if err = s.Balance.Check(doc.CompanyID); err != nil {
+		os.Remove(file.Path)
+		return "", err
+	}
+	if err = s.Quota.Reserve(doc.CompanyID, doc.Size); err != nil {
+		os.Remove(file.Path)
+		return "", err
+	}
+	if s.Blobs == nil {
+		if err = putFile(s.Storage, name, file.Path); err == nil {
+			err = os.Remove(file.Path)
+		}
+	} else {
+		var blob string
+		if blob, err = s.Blobs.PutFile(doc.Hash, file.Path); err == nil {
+			err = s.Storage.Link(blob, name)
+		}
+	}
+	if err == nil {
+		err = s.saveMeta(name, doc, file.Header, file.MIME)
+	}
+	if err != nil {
+		s.Quota.Release(doc.CompanyID, doc.Size)
+		return "", fmt.Errorf("[SaveDownloaded] error: %v", err)
+	}
+
+	doc.Path = name
+	return name, s.addDocument(doc)
+}
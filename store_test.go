@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	d "./db"
+	"./storage"
+)
+
+func TestSaveByURL(t *testing.T) {
+	dir := t.TempDir()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}}, nil)
+	store := NewDocumentStore(storageConfig{}, storage.NewLocal(dir), memory)
+
+	u := "https://a.com/docs/report?id=1&lang=en"
+	name := documentName("common/Tech/a.com", u, ".html")
+	saved, err := store.Save(d.Documents{CompanyID: 1, Crawler: "common", URL: u}, []byte("<html>1</html>"), name, nil)
+	if err != nil || saved != name {
+		t.Fatalf("Save = %v, %v", saved, err)
+	}
+	back, err := url.PathUnescape(path.Base(name[:len(name)-len(".html")]))
+	if err != nil || back != u {
+		t.Fatalf("name %v is decoded to %v, %v", name, back, err)
+	}
+
+	// The same URL is saved only once, name doesn't change
+	saved, err = store.Save(d.Documents{CompanyID: 1, Crawler: "common", URL: u}, []byte("<html>2</html>"), name, nil)
+	if err != nil || saved != "" {
+		t.Fatalf("second Save = %v, %v", saved, err)
+	}
+	content, err := store.Storage.Get(name)
+	if err != nil || string(content) != "<html>1</html>" {
+		t.Fatalf("saved content = %q, %v", content, err)
+	}
+	if documents := memory.GetDocuments(); len(documents) != 1 || documents[0].Path != name {
+		t.Fatalf("documents = %+v", documents)
+	}
+}
+
+// countFiles ... Returns amount of regular files in folder and its subfolders
+func countFiles(t *testing.T, dir string) int {
+	count := 0
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestContentAddressed(t *testing.T) {
+	dir := t.TempDir()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com"}, {URL: "b.com"}}, nil)
+	store := NewDocumentStore(storageConfig{ContentAddressed: true, Blobs: "blobs"}, storage.NewLocal(dir), memory)
+	content := []byte("%PDF-1.4 annual report")
+
+	// Identical content is saved into folder of company once and kept in one blob for all companies
+	for _, test := range []struct {
+		companyID int
+		name      string
+		saved     bool
+	}{
+		{1, "common/Tech/a.com/report.pdf", true},
+		{1, "common/Tech/a.com/copy-of-report.pdf", false},
+		{2, "common/Tech/b.com/report.pdf", true},
+	} {
+		saved, err := store.Save(d.Documents{CompanyID: test.companyID, Crawler: "common"}, content, test.name, nil)
+		if err != nil || (saved != "") != test.saved {
+			t.Fatalf("Save(%v) = %v, %v", test.name, saved, err)
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "downloaded.pdf")
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := DownloadResult{Path: filename, Size: int64(len(content)), SHA256: contentHash(content)}
+	if saved, err := store.SaveDownloaded(d.Documents{CompanyID: 2, Crawler: "google"}, file, "google/Tech/b.com/report.pdf"); err != nil || saved == "" {
+		t.Fatalf("SaveDownloaded = %v, %v", saved, err)
+	}
+
+	if blobs := countFiles(t, filepath.Join(dir, "blobs")); blobs != 1 {
+		t.Fatalf("blobs = %v", blobs)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("downloaded file is left: %v", err)
+	}
+	for _, doc := range memory.GetDocuments() {
+		saved, err := store.Storage.Get(doc.Path)
+		if err != nil || string(saved) != string(content) || doc.Hash != contentHash(content) {
+			t.Fatalf("document %+v: %q, %v", doc, saved, err)
+		}
+	}
+	if documents := memory.GetDocuments(); len(documents) != 3 {
+		t.Fatalf("documents = %+v", documents)
+	}
+}
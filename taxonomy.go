@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	d "./db"
+	"gopkg.in/yaml.v2"
+)
+
+// LoadTaxonomyFile ... Reads taxonomy definition from CSV, JSON or YAML file. CSV file has header with `level`, `code`,
+// `name` and `parent` columns. JSON and YAML files have `name`, `description` and `classes` list of the same fields.
+// Name of taxonomy is taken from file name if it is not defined
+func LoadTaxonomyFile(filename string) (d.TaxonomyDefinition, error) {
+	def := d.TaxonomyDefinition{}
+	f, err := os.Open(filename)
+	if err != nil {
+		return def, fmt.Errorf("[LoadTaxonomyFile] error: %v", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&def)
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(f).Decode(&def)
+	case ".csv":
+		def.Classes, err = readTaxonomyCSV(f)
+	default:
+		err = fmt.Errorf("unknown format, CSV, JSON or YAML is expected")
+	}
+	if err != nil {
+		return def, fmt.Errorf("[LoadTaxonomyFile] %v: %v", filename, err)
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	return def, nil
+}
+
+// readTaxonomyCSV ... Reads classes from CSV, columns are found by names in header
+func readTaxonomyCSV(r io.Reader) ([]d.ClassDefinition, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"level", "name"} {
+		if _, found := columns[name]; !found {
+			return nil, fmt.Errorf("column %v is missing", name)
+		}
+	}
+	value := func(record []string, name string) string {
+		if i, found := columns[name]; found && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	classes := []d.ClassDefinition{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return classes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, d.ClassDefinition{Level: value(record, "level"), Code: value(record, "code"),
+			Name: value(record, "name"), Parent: value(record, "parent")})
+	}
+}
+
+// ImportTaxonomies ... Loads taxonomy definitions from files into database
+func ImportTaxonomies(db *d.Database, files []string) error {
+	for _, filename := range files {
+		def, err := LoadTaxonomyFile(filename)
+		if err != nil {
+			return err
+		}
+		if err = db.ImportTaxonomy(def); err != nil {
+			return err
+		}
+		fmt.Printf("Taxonomy %v imported: %v classes\n", def.Name, len(def.Classes))
+	}
+	return db.ResolveCompanies()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	d "./db"
+)
+
+// Sectors taxonomy in all supported formats
+var sectorFiles = map[string]string{
+	"sectors.csv": `level, code, name, parent
+economic_sector, 50, Energy,
+business_sector, 5010, Fossil Fuels, 50
+industry, , Oil Exploration, Fossil Fuels
+`,
+	"sectors.json": `{"name": "sectors", "classes": [
+	{"level": "economic_sector", "code": "50", "name": "Energy"},
+	{"level": "business_sector", "code": "5010", "name": "Fossil Fuels", "parent": "50"},
+	{"level": "industry", "name": "Oil Exploration", "parent": "Fossil Fuels"}]}`,
+	"sectors.yaml": `classes:
+  - level: economic_sector
+    code: "50"
+    name: Energy
+  - level: business_sector
+    code: "5010"
+    name: Fossil Fuels
+    parent: "50"
+  - level: industry
+    name: Oil Exploration
+    parent: Fossil Fuels
+`,
+}
+
+func writeTaxonomy(t *testing.T, name, content string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadTaxonomyFile(t *testing.T) {
+	want := d.TaxonomyDefinition{Name: "sectors", Classes: []d.ClassDefinition{
+		{Level: d.LevelEconomic, Code: "50", Name: "Energy"},
+		{Level: d.LevelBusiness, Code: "5010", Name: "Fossil Fuels", Parent: "50"},
+		{Level: d.LevelIndustry, Name: "Oil Exploration", Parent: "Fossil Fuels"}}}
+	for name, content := range sectorFiles {
+		def, err := LoadTaxonomyFile(writeTaxonomy(t, name, content))
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(def, want) {
+			t.Errorf("%v: loaded %+v, want %+v", name, def, want)
+		}
+	}
+
+	for _, example := range []string{"trbc.csv", "topics.json"} {
+		def, err := LoadTaxonomyFile(filepath.Join("database_examples", example))
+		if err != nil || len(def.Classes) == 0 {
+			t.Errorf("%v: %v classes, error %v", example, len(def.Classes), err)
+		}
+	}
+}
+
+func TestLoadMalformedTaxonomy(t *testing.T) {
+	tests := []struct {
+		name, content, message string
+	}{
+		{"missing.csv", "level,code,parent\nindustry,10,\n", "column name is missing"},
+		{"fields.csv", "level,name\nindustry,Banks\nindustry,Oil,extra\n", "wrong number of fields"},
+		{"quote.csv", "level,name\nindustry,\"Banks\n", "quote"},
+		{"empty.csv", "", "EOF"},
+		{"broken.json", `{"name": "sectors", "classes": [`, "unexpected EOF"},
+		{"types.json", `{"classes": {"level": "industry"}}`, "cannot unmarshal"},
+		{"broken.yaml", "classes:\n  - level: industry\n   name: [Banks\n", "yaml"},
+		{"types.yml", "classes: industry\n", "cannot unmarshal"},
+		{"sectors.xml", "<classes/>", "unknown format"},
+	}
+	for _, test := range tests {
+		_, err := LoadTaxonomyFile(writeTaxonomy(t, test.name, test.content))
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%v: error %v, want %q", test.name, err, test.message)
+		}
+	}
+	if _, err := LoadTaxonomyFile(filepath.Join(t.TempDir(), "absent.csv")); err == nil {
+		t.Error("absent file is loaded")
+	}
+}
@@ -1,61 +1,66 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
-
-	d "./db"
 )
 
+var mimeExtensions = map[string]string{"text/xml": ".xml", "text/html": ".html", "application/pdf": ".pdf", "text/plain": ".txt", "application/msword": ".doc"}
+
 // ExtensionByContent ... Returns extension of file by detecting its MIME type, `.none` returned if no MIME found
 func ExtensionByContent(content []byte) string {
 	contentType := http.DetectContentType([]byte(content))
-	splitted := strings.Split(contentType, "; ")[0]
-	extenstions := map[string]string{"text/xml": ".xml", "text/html": ".html", "application/pdf": ".pdf", "text/plain": ".txt", "application/msword": ".doc"}
-	if extenstions[splitted] == "" {
+	return ExtensionByMIME(contentType)
+}
+
+// ExtensionByMIME ... Returns extension for MIME type, `.none` returned if MIME is unknown
+func ExtensionByMIME(contentType string) string {
+	splitted := strings.Split(contentType, ";")[0]
+	if mimeExtensions[splitted] == "" {
 		//log.Println("[extensionByContent] No extension for " + splitted)
 		return ".none"
 	}
-	return extenstions[splitted]
+	return mimeExtensions[splitted]
 }
 
-// EscapeURL ... Makes possible to create files with URL name by replacing system chars with %<char code>
-func EscapeURL(url string) string {
-	badChars := []string{"/", "\\", ":", "?"}
-	escapedURL := ""
+// Longest name of file made from URL. Leaves room for extension and sidecar suffix
+const maxNameLength = 180
 
-	for _, urlChar := range url {
-		for i, badChar := range badChars {
-			if string(urlChar) == badChar {
-				conv := strconv.Itoa(int(urlChar))
-				escapedURL += "%" + conv
-				break
-			} else if i == len(badChars)-1 {
-				escapedURL += string(urlChar)
-			}
+// EscapeURL ... Makes file name from URL. Every byte except letters, digits, `.`, `-` and `_` is replaced with
+// %XX, so name is valid on any file system and decoded back by `url.PathUnescape`. Too long names are cut and
+// end with `~` and hash of the whole URL
+func EscapeURL(rawURL string) string {
+	var b strings.Builder
+	for i := 0; i < len(rawURL); i++ {
+		c := rawURL[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '.' || c == '-' || c == '_' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
 		}
 	}
-	return escapedURL
-}
-
-// FilenameFromURL ... returns filename from URL
-func FilenameFromURL(url string) string {
-	items := strings.Split(url, "/")
-	return items[len(items)-1]
-}
+	name := b.String()
+	if len(name) <= maxNameLength {
+		return name
+	}
 
-func randString(len int) string {
-	bytes := make([]byte, len)
-	for i := 0; i < len; i++ {
-		bytes[i] = byte(65 + rand.Intn(25)) //A=65 and Z = 65+25
+	// Do not split %XX sequence
+	cut := maxNameLength - 17
+	if name[cut-1] == '%' {
+		cut--
+	} else if name[cut-2] == '%' {
+		cut -= 2
 	}
-	return string(bytes)
+	sum := sha256.Sum256([]byte(rawURL))
+	return name[:cut] + "~" + hex.EncodeToString(sum[:8])
 }
 
 func randomOption(options []string) string {
@@ -66,15 +71,35 @@ func randomOption(options []string) string {
 
 // CreateDir ... Create directory if not exists
 func CreateDir(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.Mkdir(path, os.ModeDir)
-		if err != nil {
-			return fmt.Errorf("[createDir] error: %v", err)
-		}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("[CreateDir] error: %v", err)
 	}
 	return nil
 }
 
+// CheckWritable ... Creates directory if it doesn't exist and checks that files can be written there
+func CheckWritable(path string) error {
+	if err := CreateDir(path); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(path, ".write_check")
+	if err != nil {
+		return fmt.Errorf("[CheckWritable] error: %v", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// syncFile ... Flushes file content to disk
+func syncFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
 // CreateDirs ... Creates directories in chosen directory from array of strings
 func CreateDirs(path string, dirs []string) error {
 	var err error
@@ -84,13 +109,6 @@ func CreateDirs(path string, dirs []string) error {
 	return err
 }
 
-func getCompanyIndustry(c d.Companies) string {
-	if c.IndustryGroups != "" {
-		return c.IndustryGroups
-	}
-	return c.Industry
-}
-
 func logToFile(location string) *log.Logger {
 	f, err := os.Create(location)
 	if err != nil {
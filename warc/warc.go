@@ -0,0 +1,108 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record ... One record of WARC file with its headers and raw content block
+type Record struct {
+	Version string
+	Header  textproto.MIMEHeader
+	Content []byte
+}
+
+// Type ... Returns value of `WARC-Type` header, e.g. `response`
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+// TargetURI ... Returns URL which was captured in the record
+func (r *Record) TargetURI() string {
+	return strings.Trim(r.Header.Get("WARC-Target-URI"), "<>")
+}
+
+// Date ... Returns capture time of the record
+func (r *Record) Date() (time.Time, error) {
+	return time.Parse(time.RFC3339, r.Header.Get("WARC-Date"))
+}
+
+// HTTPResponse ... Parses content of `response` record as HTTP response. Body of returned response is already read
+// into `payload`
+func (r *Record) HTTPResponse() (*http.Response, []byte, error) {
+	if r.Type() != "response" {
+		return nil, nil, fmt.Errorf("[HTTPResponse] record type is %v", r.Type())
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Content)), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[HTTPResponse] error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, nil, fmt.Errorf("[HTTPResponse] body error: %v", err)
+	}
+	return resp, payload, nil
+}
+
+// Reader ... Sequentially reads records from plain or gzipped WARC stream
+type Reader struct {
+	reader *bufio.Reader
+	text   *textproto.Reader
+}
+
+// NewReader ... Creates reader, gzip compression is detected by magic bytes. Files made of
+// several gzip members (one per record) are supported
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("[NewReader] gzip error: %v", err)
+		}
+		buffered = bufio.NewReader(gz)
+	}
+	return &Reader{reader: buffered, text: textproto.NewReader(buffered)}, nil
+}
+
+// Next ... Returns next record of the stream, `io.EOF` is returned when there are no more records
+func (r *Reader) Next() (*Record, error) {
+	// Skip empty lines which separate records
+	version := ""
+	for version == "" {
+		line, err := r.text.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		version = strings.TrimSpace(line)
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("[Next] unexpected record start: %q", version)
+	}
+
+	header, err := r.text.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("[Next] header error: %v", err)
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("[Next] bad Content-Length: %v", err)
+	}
+
+	content := make([]byte, length)
+	if _, err = io.ReadFull(r.reader, content); err != nil {
+		return nil, fmt.Errorf("[Next] content error: %v", err)
+	}
+	return &Record{Version: version, Header: header, Content: content}, nil
+}
@@ -0,0 +1,269 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer ... Writes gzipped WARC records into files of limited size. New file is started when
+// current one exceeds `MaxSize`. Safe for concurrent use
+type Writer struct {
+	Dir     string
+	Prefix  string
+	MaxSize int64
+	// OnFinish ... Optionally called with path of each file after it is completed and closed
+	OnFinish func(filename string) error
+
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	counter int
+}
+
+// openSuffix ... Marks WARC file which is still being written
+const openSuffix = ".open"
+
+// NewWriter ... Creates writer which puts files named `<prefix>-<time>-<number>.warc.gz` into `dir`.
+// File is written as `<name>.open` and renamed when it is completed
+func NewWriter(dir string, prefix string, maxSize int64) *Writer {
+	return &Writer{Dir: dir, Prefix: prefix, MaxSize: maxSize}
+}
+
+// Write ... Appends records to current file as separate gzip members, so they can be read by offset
+func (w *Writer) Write(records ...*Record) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil || (w.MaxSize > 0 && w.size >= w.MaxSize) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		data, err := r.gzipped()
+		if err != nil {
+			return fmt.Errorf("[Write] error: %v", err)
+		}
+		n, err := w.file.Write(data)
+		w.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("[Write] error: %v", err)
+		}
+	}
+	return nil
+}
+
+// Close ... Closes current file
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.finish()
+}
+
+// finish ... Closes current file and passes it to `OnFinish`
+func (w *Writer) finish() error {
+	if w.file == nil {
+		return nil
+	}
+	// File gets its final name only when all its records are on disk
+	filename := strings.TrimSuffix(w.file.Name(), openSuffix)
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(w.file.Name(), filename)
+	}
+	w.file = nil
+	if err == nil && w.OnFinish != nil {
+		err = w.OnFinish(filename)
+	}
+	return err
+}
+
+func (w *Writer) rotate() error {
+	if err := w.finish(); err != nil {
+		return fmt.Errorf("[rotate] error: %v", err)
+	}
+	w.counter++
+	name := fmt.Sprintf("%v-%v-%05d.warc.gz", w.Prefix, time.Now().UTC().Format("20060102150405"), w.counter)
+	f, err := os.OpenFile(path.Join(w.Dir, name+openSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("[rotate] error: %v", err)
+	}
+	w.file = f
+	w.size = 0
+
+	info := NewRecord("warcinfo", "", []byte("software: business_data_miner\r\nformat: WARC File Format 1.0\r\n"))
+	info.Header.Set("WARC-Filename", name)
+	info.Header.Set("Content-Type", "application/warc-fields")
+	data, err := info.gzipped()
+	if err != nil {
+		return fmt.Errorf("[rotate] error: %v", err)
+	}
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+// NewRecord ... Creates record with generated ID and current date
+func NewRecord(recordType string, targetURI string, content []byte) *Record {
+	header := textproto.MIMEHeader{}
+	header.Set("WARC-Type", recordType)
+	header.Set("WARC-Record-ID", newRecordID())
+	header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	if targetURI != "" {
+		header.Set("WARC-Target-URI", targetURI)
+	}
+	header.Set("WARC-Block-Digest", Digest(content))
+	return &Record{Version: "WARC/1.0", Header: header, Content: content}
+}
+
+// NewRequestRecord ... Creates `request` record from HTTP request line and headers
+func NewRequestRecord(method string, targetURI string, header http.Header) *Record {
+	block := &bytes.Buffer{}
+	requestURI := targetURI
+	host := ""
+	if req, err := http.NewRequest(method, targetURI, nil); err == nil {
+		requestURI = req.URL.RequestURI()
+		host = req.URL.Host
+	}
+	fmt.Fprintf(block, "%v %v HTTP/1.1\r\nHost: %v\r\n", method, requestURI, host)
+	header.Write(block)
+	block.WriteString("\r\n")
+
+	record := NewRecord("request", targetURI, block.Bytes())
+	record.Header.Set("Content-Type", "application/http; msgtype=request")
+	return record
+}
+
+// NewResponseRecord ... Creates `response` record from HTTP status, headers and already decoded payload
+func NewResponseRecord(targetURI string, status int, header http.Header, payload []byte) *Record {
+	block := &bytes.Buffer{}
+	fmt.Fprintf(block, "HTTP/1.1 %d %v\r\n", status, http.StatusText(status))
+
+	// Payload is stored decoded, so headers of transfer encoding are not valid anymore
+	cleaned := http.Header{}
+	for k, v := range header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Encoding", "Transfer-Encoding", "Content-Length":
+		default:
+			cleaned[k] = v
+		}
+	}
+	cleaned.Set("Content-Length", strconv.Itoa(len(payload)))
+	cleaned.Write(block)
+	block.WriteString("\r\n")
+	block.Write(payload)
+
+	record := NewRecord("response", targetURI, block.Bytes())
+	record.Header.Set("Content-Type", "application/http; msgtype=response")
+	record.Header.Set("WARC-Payload-Digest", Digest(payload))
+	return record
+}
+
+// NewResourceRecord ... Creates `resource` record of payload which is not original HTTP response, e.g. content
+// replayed by web archive. Date is capture time of content and source is URI from which it was loaded
+func NewResourceRecord(targetURI string, sourceURI string, date time.Time, contentType string, payload []byte) *Record {
+	record := NewRecord("resource", targetURI, payload)
+	record.SetDate(date)
+	if sourceURI != "" {
+		record.Header.Set("WARC-Source-URI", sourceURI)
+	}
+	if contentType != "" {
+		record.Header.Set("Content-Type", contentType)
+	}
+	record.Header.Set("WARC-Payload-Digest", Digest(payload))
+	return record
+}
+
+// SetDate ... Sets capture time of record, current time is kept if date is unknown
+func (r *Record) SetDate(date time.Time) {
+	if !date.IsZero() {
+		r.Header.Set("WARC-Date", date.UTC().Format(time.RFC3339))
+	}
+}
+
+// Concurrent ... Links `request` record to its `response`
+func Concurrent(request *Record, response *Record) {
+	request.Header.Set("WARC-Concurrent-To", response.Header.Get("WARC-Record-ID"))
+}
+
+// Digest ... Returns SHA-1 digest of data in base32 form used by WARC and CDX files
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func newRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// gzipped ... Serializes record into separate gzip member
+func (r *Record) gzipped() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+
+	version := r.Version
+	if version == "" {
+		version = "WARC/1.0"
+	}
+	fmt.Fprintf(gz, "%v\r\n", version)
+
+	// Write headers in stable order with WARC-Type first
+	r.Header.Set("Content-Length", strconv.Itoa(len(r.Content)))
+	keys := []string{}
+	for k := range r.Header {
+		if k != "Warc-Type" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"Warc-Type"}, keys...)
+	for _, k := range keys {
+		for _, v := range r.Header[k] {
+			fmt.Fprintf(gz, "%v: %v\r\n", warcHeaderName(k), v)
+		}
+	}
+	gz.Write([]byte("\r\n"))
+	gz.Write(r.Content)
+	gz.Write([]byte("\r\n\r\n"))
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// warcHeaderName ... Restores spelling of WARC headers changed by MIME canonicalization, e.g. `Warc-Type`
+func warcHeaderName(key string) string {
+	names := map[string]string{
+		"Warc-Type": "WARC-Type", "Warc-Record-Id": "WARC-Record-ID", "Warc-Date": "WARC-Date",
+		"Warc-Target-Uri": "WARC-Target-URI", "Warc-Block-Digest": "WARC-Block-Digest",
+		"Warc-Payload-Digest": "WARC-Payload-Digest", "Warc-Concurrent-To": "WARC-Concurrent-To",
+		"Warc-Filename": "WARC-Filename", "Warc-Ip-Address": "WARC-IP-Address",
+		"Warc-Warcinfo-Id": "WARC-Warcinfo-ID", "Warc-Identified-Payload-Type": "WARC-Identified-Payload-Type",
+		"Warc-Truncated": "WARC-Truncated", "Warc-Refers-To": "WARC-Refers-To", "Warc-Source-Uri": "WARC-Source-URI",
+	}
+	if name, found := names[key]; found {
+		return name
+	}
+	return key
+}
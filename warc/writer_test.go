@@ -0,0 +1,150 @@
+package warc
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readAll ... Reads all records of WARC file
+func readAll(t *testing.T, filename string) []*Record {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []*Record{}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+// finishedFiles ... Returns completed WARC files of folder
+func finishedFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExchangeRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir, "colly", 0)
+	response := NewResponseRecord("http://a.com/p?q=1", 200,
+		http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}}, []byte("<html>ok</html>"))
+	request := NewRequestRecord("GET", "http://a.com/p?q=1", http.Header{"User-Agent": {"test"}})
+	Concurrent(request, response)
+	if err := w.Write(request, response); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := finishedFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+	records := readAll(t, files[0])
+	if len(records) != 3 || records[0].Type() != "warcinfo" || records[1].Type() != "request" || records[2].Type() != "response" {
+		t.Fatalf("unexpected records: %v", len(records))
+	}
+	if records[1].Header.Get("WARC-Concurrent-To") != records[2].Header.Get("WARC-Record-ID") {
+		t.Fatal("request is not linked to response")
+	}
+	resp, payload, err := records[2].HTTPResponse()
+	if err != nil || string(payload) != "<html>ok</html>" || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("HTTPResponse = %q, %v", payload, err)
+	}
+	if records[2].TargetURI() != "http://a.com/p?q=1" {
+		t.Fatalf("TargetURI = %v", records[2].TargetURI())
+	}
+}
+
+func TestResourceRecord(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir, "wayback", 0)
+	captured := time.Date(2015, 3, 4, 5, 6, 7, 0, time.UTC)
+	source := "https://web.archive.org/web/20150304050607id_/http://a.com/report.pdf"
+	if err := w.Write(NewResourceRecord("http://a.com/report.pdf", source, captured, "application/pdf", []byte("%PDF-1.4"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAll(t, finishedFiles(t, dir)[0])
+	resource := records[len(records)-1]
+	if resource.Type() != "resource" || resource.TargetURI() != "http://a.com/report.pdf" {
+		t.Fatalf("record %v of %v", resource.Type(), resource.TargetURI())
+	}
+	if date, err := resource.Date(); err != nil || !date.Equal(captured) {
+		t.Fatalf("Date = %v, %v, want capture time %v", date, err, captured)
+	}
+	if resource.Header.Get("WARC-Source-URI") != source || resource.Header.Get("Content-Type") != "application/pdf" {
+		t.Fatalf("headers = %v", resource.Header)
+	}
+	if string(resource.Content) != "%PDF-1.4" || resource.Header.Get("WARC-Payload-Digest") != Digest(resource.Content) {
+		t.Fatalf("content = %q", resource.Content)
+	}
+}
+
+func TestSetDate(t *testing.T) {
+	record := NewRecord("response", "http://a.com/", nil)
+	now := record.Header.Get("WARC-Date")
+	record.SetDate(time.Time{})
+	if record.Header.Get("WARC-Date") != now {
+		t.Fatal("unknown date replaced current one")
+	}
+	record.SetDate(time.Date(2001, 2, 3, 4, 5, 6, 0, time.FixedZone("MSK", 3*3600)))
+	if got := record.Header.Get("WARC-Date"); got != "2001-02-03T01:05:06Z" {
+		t.Fatalf("WARC-Date = %v", got)
+	}
+}
+
+func TestOpenFileRenamed(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir, "colly", 0)
+	finished := []string{}
+	w.OnFinish = func(filename string) error {
+		finished = append(finished, filename)
+		return nil
+	}
+	if err := w.Write(NewResponseRecord("http://a.com/", 200, http.Header{}, []byte("ok"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Incomplete file is not visible under final name
+	open, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"+openSuffix))
+	if err != nil || len(open) != 1 || len(finishedFiles(t, dir)) != 0 {
+		t.Fatalf("open files = %v, finished = %v", open, finishedFiles(t, dir))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := finishedFiles(t, dir)
+	if len(files) != 1 || files[0]+openSuffix != open[0] || !reflect.DeepEqual(finished, files) {
+		t.Fatalf("finished files = %v, OnFinish got %v", files, finished)
+	}
+	if _, err := os.Stat(open[0]); !os.IsNotExist(err) {
+		t.Fatalf("open file is left: %v", err)
+	}
+	if records := readAll(t, files[0]); len(records) != 2 {
+		t.Fatalf("records = %v", len(records))
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"./cdx"
+	d "./db"
+)
+
+// WaybackConfig ... Holds configuration parameters for Wayback Machine crawler
+type WaybackConfig struct {
+	ResChanel  chan ArchiveResultChan
+	Client     *cdx.WaybackClient
+	Query      cdx.Query
+	Keep       string
+	Period     string
+	Extensions []string
+	MaxAmount  int
+	Wait       time.Duration
+	Archive    *Archiver
+	Store      *DocumentStore
+	Industry   string
+}
+
+// waybackQuery ... Makes query template of Wayback CDX server from configuration
+func waybackQuery(config waybackConfig) cdx.Query {
+	query := cdx.Query{MatchType: "prefix", From: config.From, To: config.To, Collapse: config.Collapse}
+	if config.StatusFilter != "" {
+		query.Filters = append(query.Filters, "statuscode:"+config.StatusFilter)
+	}
+	if config.MIMEFilter != "" {
+		query.Filters = append(query.Filters, "mimetype:"+config.MIMEFilter)
+	}
+	return query
+}
+
+// FetchWayback ... Searches captures of all sites of company in Wayback Machine and saves their original content
+func FetchWayback(c d.Companies, saveto string, config WaybackConfig) {
+	if err := config.Store.Check(c.ID); err != nil {
+		config.ResChanel <- ArchiveResultChan{URL: c.URL, Error: err}
+		config.ResChanel <- ArchiveResultChan{URL: c.URL, Done: true, Stopped: true}
+		return
+	}
+	captures := []capture{}
+	failures := 0
+	for _, site := range c.Sites() {
+		query := config.Query
+		query.URL = site
+		records, err := config.Client.Search(query)
+		if err != nil {
+			failures++
+			config.ResChanel <- ArchiveResultChan{URL: c.URL, Error: fmt.Errorf("[FetchWayback] %v: %v", site, err)}
+		}
+
+		// Skip captures which definitely will not be saved
+		for _, r := range records {
+			if ext := ExtensionByMIME(r.MIME); ext != ".none" && !IsExtensionExist(config.Extensions, ext) {
+				continue
+			}
+			captures = append(captures, capture{r, r.Timestamp})
+		}
+	}
+	// Company whose captures are not known is left for the next run
+	if failures > 0 && failures == len(c.Sites()) {
+		config.ResChanel <- ArchiveResultChan{URL: c.URL, Done: true, Failed: true}
+		return
+	}
+
+	save := func(capt capture, folder string, period string) error {
+		return saveWayback(c, capt, folder, period, config)
+	}
+	stopped := saveCaptures(c, [][]capture{captures}, saveto, config.Keep, config.Period, config.MaxAmount, config.Wait,
+		config.ResChanel, save)
+	config.ResChanel <- ArchiveResultChan{URL: c.URL, Done: true, Stopped: stopped}
+}
+
+// saveWayback ... Loads original content of capture and saves it if extension is allowed
+func saveWayback(c d.Companies, capt capture, saveto string, period string, config WaybackConfig) error {
+	if err := config.Store.Check(c.ID); err != nil {
+		return err
+	}
+	resp, payload, err := config.Client.Fetch(capt.Record)
+	if err != nil {
+		return fmt.Errorf("[saveWayback] %v: %v", capt.URL, err)
+	}
+	capturedAt, _ := capt.Time()
+	err = config.Archive.WriteResource("wayback", config.Industry, capt.URL, resp.Request.URL.String(), capturedAt,
+		resp.Header.Get("Content-Type"), payload)
+	if err != nil {
+		return fmt.Errorf("[saveWayback] %v: %v", capt.URL, err)
+	}
+
+	doc := d.Documents{CompanyID: c.ID, Crawler: "wayback", URL: capt.URL, Snapshot: capt.Snapshot,
+		CapturedAt: capturedAt, Period: period}
+	_, err = saveArchived(doc, resp.Header, payload, saveto, config.Extensions, config.Store)
+	return err
+}
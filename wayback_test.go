@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"./cdx"
+	d "./db"
+	"./storage"
+)
+
+func TestWaybackUnavailable(t *testing.T) {
+	// Index times out for sites of a.com, b.com has no captures on its second domain
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("url") {
+		case "a.com", "a.ru", "b.com":
+			http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer server.Close()
+	memory := d.NewMemory([]d.Companies{{URL: "a.com", Domains: []string{"a.ru"}}, {URL: "b.com", Domains: []string{"b.ru"}}}, nil)
+	config := WaybackConfig{Client: cdx.NewWaybackClient(server.URL, server.URL, time.Second),
+		Store: NewDocumentStore(storageConfig{}, storage.NewLocal(t.TempDir()), memory)}
+
+	for i, c := range memory.GetCompanies() {
+		results := fetchResults(func(resChan chan ArchiveResultChan) {
+			config.ResChanel = resChan
+			FetchWayback(c, t.TempDir(), config)
+		})
+		last := results[len(results)-1]
+		if failed := i == 0; len(results)-1 != 2-i || last.Failed != failed || last.Stopped {
+			t.Errorf("%v: %+v", c.URL, results)
+		}
+	}
+}